@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/wptgit"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// flaggedRun is reported for runs whose FullRevisionHash cannot be backfilled.
+type flaggedRun struct {
+	ID               int64  `json:"id"`
+	Revision         string `json:"revision"`
+	FullRevisionHash string `json:"full_revision_hash,omitempty"`
+	Reason           string `json:"reason"`
+}
+
+// fullRevisionHashBackfill sets the FullRevisionHash of runs that lack one by
+// resolving their (abbreviated) Revision in the local WPT checkout.
+type fullRevisionHashBackfill struct {
+	Revisions *wptgit.Resolver
+
+	mutex   *sync.Mutex
+	flagged map[int64]flaggedRun
+}
+
+func (b fullRevisionHashBackfill) flag(run *shared.TestRun, reason string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flagged[run.ID] = flaggedRun{
+		ID:               run.ID,
+		Revision:         run.Revision,
+		FullRevisionHash: run.FullRevisionHash,
+		Reason:           reason,
+	}
+}
+
+func (b fullRevisionHashBackfill) ShouldProcessRun(run *shared.TestRun) bool {
+	hash, err := b.Revisions.Resolve(run.Revision)
+	if err != nil {
+		b.flag(run, err.Error())
+		return false
+	}
+	if run.FullRevisionHash == "" {
+		return true
+	}
+	if run.FullRevisionHash != hash {
+		// Never overwrite an existing hash; it may be more accurate than the
+		// abbreviated revision.
+		b.flag(run, "Conflicting FullRevisionHash "+hash)
+	}
+	return false
+}
+
+func (b fullRevisionHashBackfill) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	hash, err := b.Revisions.Resolve(run.Revision)
+	if err != nil {
+		return err
+	}
+	run.FullRevisionHash = hash
+	_, err = tx.Put(key, run)
+	return err
+}
+
+// Report lists the runs with unknown or ambiguous revisions, or with a
+// FullRevisionHash that does not match their revision.
+func (b fullRevisionHashBackfill) Report() interface{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	flagged := make([]flaggedRun, 0, len(b.flagged))
+	for _, run := range b.flagged {
+		flagged = append(flagged, run)
+	}
+	return flagged
+}
+
+func main() {
+	flag.Parse()
+	index, err := wptgit.IndexAllCommits(wptgit.Open())
+	if err != nil {
+		log.Fatalf("Failed to index revisions: %s", err.Error())
+	}
+	processor.MigrateData(fullRevisionHashBackfill{
+		Revisions: wptgit.NewResolver(index),
+		mutex:     &sync.Mutex{},
+		flagged:   make(map[int64]flaggedRun),
+	})
+}
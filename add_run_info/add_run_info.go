@@ -11,53 +11,83 @@ import (
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/storage"
 
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/productspec"
+	"github.com/web-platform-tests/data-migration/profile"
 	"github.com/web-platform-tests/results-analysis/metrics"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 )
 
 var projectID *string
 var gcsBucket *string
+var runFilter productspec.ProductSpecs
 
 const gcsPrefix string = "https://storage.googleapis.com/"
 
 func init() {
 	projectID = flag.String("project", "wptdashboard-staging", "Google Cloud Platform project ID")
 	gcsBucket = flag.String("bucket", "wptd-results-staging", "Only process reports in this bucket")
+	flag.Var(&runFilter, "runs", productspec.Usage)
 }
 
-func process(ctx context.Context, ds *datastore.Client, gcs *storage.Client, key *datastore.Key) error {
+// migration is a run whose raw report is to be rewritten.
+type migration struct {
+	key        *datastore.Key
+	testRun    shared.TestRun
+	reportPath string
+}
+
+// check reads the run and returns its migration, or nil if it is skipped.
+func check(ctx context.Context, ds *datastore.Client, gcs *storage.Client, key *datastore.Key) (*migration, error) {
 	var testRun shared.TestRun
 	if err := ds.Get(ctx, key, &testRun); err != nil {
-		return err
+		return nil, err
 	}
 
+	if !runFilter.Matches(&testRun) {
+		return nil, nil
+	}
 	if testRun.RawResultsURL == "" {
 		log.Printf("TestRun %d doesn't have a raw report, skipping.", key.ID)
-		return nil
+		return nil, nil
 	}
 	if !strings.HasPrefix(testRun.RawResultsURL, gcsPrefix+*gcsBucket+"/") {
 		log.Printf("TestRun %d 's raw report is not in %s, skipping.", key.ID, *gcsBucket)
-		return nil
+		return nil, nil
 	}
 	if !strings.HasSuffix(testRun.RawResultsURL, "report.json") {
 		log.Printf("Unrecognized report URL %s.", testRun.RawResultsURL)
-		return nil
+		return nil, nil
 	}
 
-	bucket := gcs.Bucket(*gcsBucket)
 	reportPath := strings.TrimPrefix(testRun.RawResultsURL, gcsPrefix+*gcsBucket+"/")
-	reportFile := bucket.Object(reportPath)
 	logPath := strings.TrimSuffix(reportPath, "report.json") + "migration.log"
-	logFile := bucket.Object(logPath)
+	logFile := gcs.Bucket(*gcsBucket).Object(logPath)
 
 	_, err := logFile.Attrs(ctx)
 	if err == storage.ErrObjectNotExist {
 		log.Printf("TestRun %d doesn't have a migrated raw report, skipping.", key.ID)
-		return nil
+		return nil, nil
 	}
 	if err != nil {
+		return nil, err
+	}
+	return &migration{key, testRun, reportPath}, nil
+}
+
+func process(ctx context.Context, ds *datastore.Client, gcs *storage.Client, m *migration) error {
+	key, reportPath := m.key, m.reportPath
+	// Re-read the run, which may have changed since it was checked.
+	var testRun shared.TestRun
+	if err := ds.Get(ctx, key, &testRun); err != nil {
 		return err
 	}
+	if testRun.RawResultsURL != m.testRun.RawResultsURL {
+		log.Printf("TestRun %d 's raw report changed since it was checked, skipping.", key.ID)
+		return nil
+	}
+	bucket := gcs.Bucket(*gcsBucket)
+	reportFile := bucket.Object(reportPath)
 
 	reader, err := reportFile.NewReader(ctx)
 	if err != nil {
@@ -107,13 +137,17 @@ func process(ctx context.Context, ds *datastore.Client, gcs *storage.Client, key
 
 func main() {
 	flag.Parse()
+	profile.Apply(map[string]string{
+		"project": "project",
+		"bucket":  "results_bucket",
+	})
 
 	ctx := context.Background()
-	ds, err := datastore.NewClient(ctx, *projectID)
+	ds, err := clients.NewDatastore(ctx, *projectID)
 	if err != nil {
 		panic(err)
 	}
-	gcs, err := storage.NewClient(ctx)
+	gcs, err := clients.NewStorage(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -123,11 +157,26 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// Find the runs to migrate first, so that the write guard (and its
+	// snapshot) runs before anything is written, and only if needed.
+	migrations := make([]*migration, 0)
 	for i, key := range keys {
-		log.Printf("[%d/%d] Processing TestRun %d...", i+1, len(keys), key.ID)
-		err := process(ctx, ds, gcs, key)
+		log.Printf("[%d/%d] Checking TestRun %d...", i+1, len(keys), key.ID)
+		m, err := check(ctx, ds, gcs, key)
 		if err != nil {
-			log.Printf("ERROR cannot process TestRun %d: %v", key.ID, err)
+			log.Printf("ERROR cannot check TestRun %d: %v", key.ID, err)
+		} else if m != nil {
+			migrations = append(migrations, m)
+		}
+	}
+	if len(migrations) == 0 {
+		return
+	}
+	profile.GuardWrite(*projectID)
+	for i, m := range migrations {
+		log.Printf("[%d/%d] Processing TestRun %d...", i+1, len(migrations), m.key.ID)
+		if err := process(ctx, ds, gcs, m); err != nil {
+			log.Printf("ERROR cannot process TestRun %d: %v", m.key.ID, err)
 		}
 	}
 }
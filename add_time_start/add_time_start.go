@@ -1,75 +1,154 @@
 package main
 
 import (
-	"context"
-	"flag"
-	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/datastore"
-	"google.golang.org/api/iterator"
 
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 )
 
-var (
-	projectID = flag.String("project", "wptdashboard-staging", "Google Cloud project")
-)
+// timeEstimated marks runs whose TimeStart or TimeEnd is the upload time,
+// because their raw report did not record when the run started or ended.
+const timeEstimated = "time-estimated"
 
-type conditionUnsatisfied struct{}
+// timeSpan is the backfilled TimeStart and TimeEnd of a run.
+type timeSpan struct {
+	Start     time.Time
+	End       time.Time
+	Estimated bool
+}
 
-func (e conditionUnsatisfied) Error() string {
-	return "Condition not satisfied"
+type fetchFailure struct {
+	ID            int64  `json:"id"`
+	RawResultsURL string `json:"raw_results_url"`
+	Error         string `json:"error"`
 }
 
-func condition(run *shared.TestRun) bool {
-	return run.TimeStart.IsZero()
+// timeBackfill sets TimeStart and TimeEnd from the time_start and time_end
+// recorded by wptrunner in the raw report, falling back to CreatedAt (and the
+// time-estimated label) if the report lacks them.
+type timeBackfill struct {
+	mutex *sync.Mutex
+	// The time_start and time_end of the prefetched reports, by run ID.
+	reportTimes map[int64][2]time.Time
+	failures    map[int64]fetchFailure
 }
 
-func operation(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
-	run.TimeStart = run.CreatedAt
-	_, err := tx.Put(key, run)
-	return err
+// needsBackfill reports whether the run's times are missing or estimated. A
+// TimeStart equal to CreatedAt was copied by an earlier version of this script.
+func needsBackfill(run *shared.TestRun) bool {
+	return run.TimeStart.IsZero() || run.TimeEnd.IsZero() ||
+		run.TimeStart.Equal(run.CreatedAt) || run.LabelsSet().Contains(timeEstimated)
 }
 
-func main() {
-	flag.Parse()
+// Prefetch fetches the raw reports of the runs that need a backfill, keeping
+// only their times.
+func (b timeBackfill) Prefetch(runs []shared.TestRun) {
+	candidates := make([]shared.TestRun, 0)
+	for i := range runs {
+		if needsBackfill(&runs[i]) {
+			candidates = append(candidates, runs[i])
+		}
+	}
+	failures := report.FetchAll(candidates, func(run shared.TestRun, r *report.Report) {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		b.reportTimes[run.ID] = [2]time.Time{r.Start(), r.End()}
+	})
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, run := range candidates {
+		if err, failed := failures[run.ID]; failed {
+			b.failures[run.ID] = fetchFailure{run.ID, run.RawResultsURL, err}
+		}
+	}
+}
 
-	ctx := context.Background()
+// span computes the run's times from its prefetched raw report and the run as
+// read in the current transaction. ok is false if the report could not be
+// fetched.
+func (b timeBackfill) span(run *shared.TestRun) (span timeSpan, ok bool) {
+	var start, end time.Time
+	if run.RawResultsURL != "" {
+		b.mutex.Lock()
+		times, fetched := b.reportTimes[run.ID]
+		b.mutex.Unlock()
+		if !fetched {
+			return timeSpan{}, false
+		}
+		start, end = times[0], times[1]
+	}
 
-	dsClient, err := datastore.NewClient(ctx, *projectID)
-	if err != nil {
-		panic(err)
+	// Keep times that were not estimated, e.g. set by the uploader.
+	wasEstimated := run.LabelsSet().Contains(timeEstimated)
+	if start.IsZero() && !wasEstimated && !run.TimeStart.Equal(run.CreatedAt) {
+		start = run.TimeStart
+	}
+	if end.IsZero() && !wasEstimated && !run.TimeEnd.Equal(run.CreatedAt) {
+		end = run.TimeEnd
+	}
+	estimated := false
+	if start.IsZero() {
+		start, estimated = run.CreatedAt, true
+	}
+	if end.IsZero() {
+		end, estimated = run.CreatedAt, true
 	}
+	return timeSpan{Start: start, End: end, Estimated: estimated}, true
+}
 
-	query := datastore.NewQuery("TestRun").KeysOnly()
+func (b timeBackfill) ShouldProcessRun(run *shared.TestRun) bool {
+	if !needsBackfill(run) {
+		return false
+	}
+	span, ok := b.span(run)
+	if !ok {
+		return false
+	}
+	return !span.Start.Equal(run.TimeStart) || !span.End.Equal(run.TimeEnd) ||
+		span.Estimated != run.LabelsSet().Contains(timeEstimated)
+}
 
-	for t := dsClient.Run(ctx, query); ; {
-		key, err := t.Next(nil)
-		if err == iterator.Done {
-			break
+func (b timeBackfill) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	span, _ := b.span(run)
+	log.Printf("TestRun %d: TimeStart %v -> %v, TimeEnd %v -> %v", run.ID, run.TimeStart, span.Start, run.TimeEnd, span.End)
+	run.TimeStart = span.Start
+	run.TimeEnd = span.End
+	labels := make([]string, 0, len(run.Labels)+1)
+	for _, label := range run.Labels {
+		if label != timeEstimated {
+			labels = append(labels, label)
 		}
-		if err != nil {
-			panic(err)
-		}
-		var run shared.TestRun
-		_, err = dsClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-			err := tx.Get(key, &run)
-			if err != nil {
-				return err
-			}
-			if condition(&run) {
-				return operation(tx, key, &run)
-			}
-			return conditionUnsatisfied{}
-		})
-		if err != nil {
-			_, ok := err.(conditionUnsatisfied)
-			if !ok {
-				panic(err)
-			} else {
-				continue
-			}
-		}
-		fmt.Printf("Proccessed TestRun %s (%s %s)\n", key.String(), run.BrowserName, run.BrowserVersion)
 	}
+	if span.Estimated {
+		labels = append(labels, timeEstimated)
+	}
+	run.Labels = labels
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the runs whose raw report could not be fetched, which are left
+// alone.
+func (b timeBackfill) Report() interface{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	failures := make([]fetchFailure, 0, len(b.failures))
+	for _, f := range b.failures {
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+func main() {
+	processor.MigrateData(timeBackfill{
+		mutex:       &sync.Mutex{},
+		reportTimes: make(map[int64][2]time.Time),
+		failures:    make(map[int64]fetchFailure),
+	})
 }
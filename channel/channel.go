@@ -0,0 +1,173 @@
+package channel
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Release channels, as used for TestRun labels.
+const (
+	Stable  = "stable"
+	Beta    = "beta"
+	Dev     = "dev"
+	Canary  = "canary"
+	Nightly = "nightly"
+	Preview = "preview"
+)
+
+// IsExperimental reports whether runs of the given channel count as
+// experimental (as opposed to stable) on wpt.fyi.
+func IsExperimental(channel string) bool {
+	switch channel {
+	case Dev, Canary, Nightly, Preview:
+		return true
+	}
+	return false
+}
+
+type pattern struct {
+	version *regexp.Regexp
+	channel string
+	// explicit is true for patterns of versions that name their channel (see
+	// Hint).
+	explicit bool
+}
+
+func p(version, channel string) pattern {
+	return pattern{regexp.MustCompile(version), channel, false}
+}
+
+// hint is p for patterns of versions that name their channel.
+func hint(version, channel string) pattern {
+	return pattern{regexp.MustCompile(version), channel, true}
+}
+
+// Version patterns of Chrome-like browsers, e.g. "70.0.3538.9 dev".
+var chromePatterns = []pattern{
+	hint(`(?i)\bcanary$`, Canary),
+	hint(`(?i)\bdev$`, Dev),
+	hint(`(?i)\bbeta$`, Beta),
+	hint(`(?i)^\d+(\.\d+)* stable$`, Stable),
+	p(`^\d+(\.\d+)*$`, Stable),
+}
+
+// Version patterns of Firefox-like browsers, e.g. "64.0a1" or "63.0b12".
+var firefoxPatterns = []pattern{
+	hint(`(?i)a\d+$`, Nightly),
+	hint(`(?i)b\d+$`, Beta),
+	hint(`(?i)^\d+(\.\d+)*esr$`, Stable),
+	p(`^\d+(\.\d+)*$`, Stable),
+}
+
+// WebKitGTK-based browsers use odd minor versions for development releases.
+var webkitGTKPatterns = []pattern{
+	hint(`(?i)nightly`, Nightly),
+	p(`^\d+\.\d*[13579](\.\d+)*$`, Dev),
+	p(`^\d+\.\d*[02468](\.\d+)*$`, Stable),
+}
+
+// patterns maps each browser name to its version patterns, in order of
+// precedence; the first match wins.
+var patterns = map[string][]pattern{
+	"chrome":          chromePatterns,
+	"chrome_android":  chromePatterns,
+	"android_webview": chromePatterns,
+	"chromium": {
+		p(`.`, Nightly),
+	},
+	"edge": append([]pattern{
+		// EdgeHTML insider builds, e.g. "18.17763 preview".
+		hint(`(?i)\b(preview|insider)$`, Dev),
+	}, chromePatterns...),
+	"firefox":         firefoxPatterns,
+	"firefox_android": firefoxPatterns,
+	"safari": {
+		hint(`(?i)technology preview|\bpreview\b`, Preview),
+		p(`^\d+(\.\d+)*( \(\d+(\.\d+)*\))?$`, Stable),
+	},
+	"webkitgtk": webkitGTKPatterns,
+	"epiphany":  webkitGTKPatterns,
+	"servo": {
+		p(`.`, Nightly),
+	},
+	"deno": {
+		hint(`(?i)canary`, Canary),
+		p(`^\d+(\.\d+)*$`, Stable),
+	},
+	"uc": {
+		p(`^\d+(\.\d+)*$`, Stable),
+	},
+}
+
+var unmatched = make(map[string]int)
+var unmatchedMutex sync.Mutex
+
+// Known reports whether there are channel patterns for the browser.
+func Known(browserName string) bool {
+	_, ok := patterns[strings.TrimSuffix(browserName, "-experimental")]
+	return ok
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// match returns the first of the browser's patterns matching the version.
+func match(browserName, browserVersion string) (pattern, bool) {
+	name := strings.TrimSuffix(browserName, "-experimental")
+	version := spaces.ReplaceAllString(strings.TrimSpace(browserVersion), " ")
+	for _, pat := range patterns[name] {
+		if pat.version.MatchString(version) {
+			return pat, true
+		}
+	}
+	return pattern{}, false
+}
+
+// Match returns the release channel of a browser version, based on the
+// browser's version patterns. The second result is false if no pattern
+// matched. Unlike Infer, it does not record unmatched versions; it is meant
+// for packages that parse versions (see version.Parse), which must agree with
+// Infer.
+func Match(browserName, browserVersion string) (string, bool) {
+	pat, ok := match(browserName, browserVersion)
+	return pat.channel, ok
+}
+
+// Hint is like Match, but only for versions that name their channel (e.g. a
+// "dev" suffix, or a Firefox alpha), rather than imply it (e.g. a plain
+// Chrome version is stable).
+func Hint(browserName, browserVersion string) (string, bool) {
+	pat, ok := match(browserName, browserVersion)
+	if !ok || !pat.explicit {
+		return "", false
+	}
+	return pat.channel, true
+}
+
+// Infer returns the release channel of a browser version, based on the
+// browser's version patterns. The second result is false if no pattern
+// matched, in which case the version is recorded for Unmatched().
+func Infer(browserName, browserVersion string) (string, bool) {
+	if c, ok := Match(browserName, browserVersion); ok {
+		return c, true
+	}
+	name := strings.TrimSuffix(browserName, "-experimental")
+	version := strings.TrimSpace(browserVersion)
+
+	unmatchedMutex.Lock()
+	defer unmatchedMutex.Unlock()
+	unmatched[name+" "+version]++
+	return "", false
+}
+
+// Unmatched returns the browser versions (prefixed by the browser name) for
+// which Infer found no channel, with the number of lookups for each.
+func Unmatched() map[string]int {
+	unmatchedMutex.Lock()
+	defer unmatchedMutex.Unlock()
+	report := make(map[string]int, len(unmatched))
+	for version, count := range unmatched {
+		report[version] = count
+	}
+	return report
+}
@@ -0,0 +1,32 @@
+package channel
+
+import "testing"
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		browser, version string
+		channel          string
+		explicit         bool
+	}{
+		{"chrome", "70.0.3538.9 dev", Dev, true},
+		{"chrome", "70.0.3538.77 Stable", Stable, true},
+		{"chrome", "70.0.3538.77", "", false},
+		{"firefox", "64.0a1", Nightly, true},
+		{"firefox", "60.2.0esr", Stable, true},
+		{"firefox", "63.0", "", false},
+		{"safari", "12.1 (Safari Technology Preview 70)", Preview, true},
+		{"webkitgtk", "2.23.1", "", false},
+		{"netscape", "4.0 beta", "", false},
+	}
+	for _, test := range tests {
+		c, explicit := Hint(test.browser, test.version)
+		if c != test.channel || explicit != test.explicit {
+			t.Errorf("Hint(%q, %q) = %q, %v; expected %q, %v", test.browser, test.version, c, explicit, test.channel, test.explicit)
+		}
+		if explicit {
+			if matched, _ := Match(test.browser, test.version); matched != c {
+				t.Errorf("Match(%q, %q) = %q, but Hint found %q", test.browser, test.version, matched, c)
+			}
+		}
+	}
+}
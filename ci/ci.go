@@ -0,0 +1,159 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// CI systems, as used for TestRun labels.
+const (
+	Azure       = "azure"
+	Buildbot    = "buildbot"
+	Taskcluster = "taskcluster"
+)
+
+// Sources are all the CI source labels.
+var Sources = []string{Azure, Buildbot, Taskcluster}
+
+// HasSourceLabel reports whether the run is labelled with a CI source.
+func HasSourceLabel(run *shared.TestRun) bool {
+	labels := run.LabelsSet()
+	for _, source := range Sources {
+		if labels.Contains(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// Confidence of a classification, from weakest to strongest.
+type Confidence int
+
+// Confidence levels.
+const (
+	None Confidence = iota
+	Medium
+	High
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case Medium:
+		return "medium"
+	case High:
+		return "high"
+	}
+	return "none"
+}
+
+// MarshalText encodes a confidence level by name.
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// ParseConfidence parses the name of a confidence level.
+func ParseConfidence(s string) (Confidence, error) {
+	for _, c := range []Confidence{None, Medium, High} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return None, fmt.Errorf("Unknown confidence level %s", s)
+}
+
+type rule struct {
+	pattern    *regexp.Regexp
+	source     string
+	confidence Confidence
+}
+
+func r(pattern, source string, confidence Confidence) rule {
+	return rule{regexp.MustCompile(pattern), source, confidence}
+}
+
+// urlRules match the RawResultsURL and ResultsURL of runs. Reports hosted by a
+// CI system are a strong signal; uploader names in the path a weaker one.
+var urlRules = []rule{
+	r(`(?i)^https?://[^/]*taskcluster[^/]*/`, Taskcluster, High),
+	r(`(?i)^https?://(dev\.azure\.com|[^/]*\.visualstudio\.com|[^/]*\.vsblob\.[^/]*)/`, Azure, High),
+	r(`(?i)[/_-](taskcluster|tc)[/_-]`, Taskcluster, Medium),
+	r(`(?i)[/_-](azure|azure-pipelines)[/_-]`, Azure, Medium),
+	r(`(?i)[/_-](buildbot|bb)[/_-]`, Buildbot, Medium),
+}
+
+// runInfoKeyRules match the keys of the report's run_info, which CI-specific
+// tooling adds to.
+var runInfoKeyRules = []rule{
+	r(`(?i)^(taskcluster|tc_)`, Taskcluster, High),
+	r(`(?i)^(azure|system_teamfoundation|build_buildid$)`, Azure, High),
+	r(`(?i)^(buildbot|buildername$|buildnumber$)`, Buildbot, High),
+}
+
+// runInfoValueRules match the (string) values of the report's run_info, e.g.
+// an uploader or hostname.
+var runInfoValueRules = []rule{
+	r(`(?i)\btaskcluster\b`, Taskcluster, Medium),
+	r(`(?i)\bazure\b`, Azure, Medium),
+	r(`(?i)\bbuildbot\b`, Buildbot, Medium),
+}
+
+// Classification is the inferred CI source of a run.
+type Classification struct {
+	Source     string     `json:"source"`
+	Confidence Confidence `json:"confidence"`
+	// Evidence describes the signals the classification is based on.
+	Evidence []string `json:"evidence"`
+}
+
+// Classify infers the CI system a run originated from, based on its URLs and
+// the run_info of its report (which may be nil). The strongest signal wins;
+// conflicting signals of the same strength leave the run unclassified
+// (Source "" and Confidence None, with the evidence of all sources), as does
+// the lack of any signal.
+func Classify(run *shared.TestRun, runInfo map[string]interface{}) Classification {
+	best := make(map[string]Confidence)
+	evidence := make(map[string][]string)
+	match := func(rules []rule, what, s string) {
+		for _, rule := range rules {
+			if rule.pattern.MatchString(s) {
+				if rule.confidence > best[rule.source] {
+					best[rule.source] = rule.confidence
+				}
+				evidence[rule.source] = append(evidence[rule.source], fmt.Sprintf("%s %q (%s)", what, s, rule.confidence))
+			}
+		}
+	}
+	for _, url := range []string{run.RawResultsURL, run.ResultsURL} {
+		if url != "" {
+			match(urlRules, "URL", url)
+		}
+	}
+	for key, value := range runInfo {
+		match(runInfoKeyRules, "run_info key", key)
+		if s, ok := value.(string); ok {
+			match(runInfoValueRules, "run_info."+key, strings.TrimSpace(s))
+		}
+	}
+
+	var c Classification
+	ambiguous := false
+	for source, confidence := range best {
+		if confidence > c.Confidence {
+			c = Classification{Source: source, Confidence: confidence, Evidence: evidence[source]}
+			ambiguous = false
+		} else if confidence == c.Confidence {
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		all := make([]string, 0)
+		for _, e := range evidence {
+			all = append(all, e...)
+		}
+		return Classification{Evidence: all}
+	}
+	return c
+}
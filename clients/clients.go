@@ -0,0 +1,93 @@
+package clients
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+const gcsPrefix = "https://storage.googleapis.com/"
+
+var datastoreEmulatorHost *string
+var storageEmulatorHost *string
+var bigtableEmulatorHost *string
+
+func init() {
+	datastoreEmulatorHost = flag.String("datastore-emulator-host", os.Getenv("DATASTORE_EMULATOR_HOST"), "host:port of a Datastore emulator to use instead of Cloud Datastore")
+	storageEmulatorHost = flag.String("storage-emulator-host", os.Getenv("STORAGE_EMULATOR_HOST"), "host:port of a GCS emulator (e.g. fake-gcs-server) to use instead of Cloud Storage")
+	bigtableEmulatorHost = flag.String("bigtable-emulator-host", os.Getenv("BIGTABLE_EMULATOR_HOST"), "host:port of a Bigtable emulator to use instead of Cloud Bigtable")
+}
+
+// NewDatastore creates a Datastore client, talking to the emulator if one is
+// configured. Credential options are dropped for the emulator, which does not
+// accept them.
+func NewDatastore(ctx context.Context, projectID string, opts ...option.ClientOption) (*datastore.Client, error) {
+	if *datastoreEmulatorHost != "" {
+		// The client library sets up an insecure, unauthenticated connection
+		// by itself when this is set.
+		os.Setenv("DATASTORE_EMULATOR_HOST", *datastoreEmulatorHost)
+		return datastore.NewClient(ctx, projectID)
+	}
+	return datastore.NewClient(ctx, projectID, opts...)
+}
+
+// NewStorage creates a GCS client, talking to the emulator if one is
+// configured.
+func NewStorage(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error) {
+	if *storageEmulatorHost != "" {
+		os.Setenv("STORAGE_EMULATOR_HOST", *storageEmulatorHost)
+		return storage.NewClient(ctx,
+			option.WithEndpoint(storageEmulatorURL()+"storage/v1/"),
+			option.WithoutAuthentication())
+	}
+	return storage.NewClient(ctx, opts...)
+}
+
+// NewBigtable creates a Bigtable client, talking to the emulator if one is
+// configured.
+func NewBigtable(ctx context.Context, projectID, instanceID string, opts ...option.ClientOption) (*bigtable.Client, error) {
+	if *bigtableEmulatorHost != "" {
+		os.Setenv("BIGTABLE_EMULATOR_HOST", *bigtableEmulatorHost)
+		return bigtable.NewClient(ctx, projectID, instanceID)
+	}
+	return bigtable.NewClient(ctx, projectID, instanceID, opts...)
+}
+
+// NewBigtableAdmin creates a Bigtable admin client, talking to the emulator if
+// one is configured.
+func NewBigtableAdmin(ctx context.Context, projectID, instanceID string, opts ...option.ClientOption) (*bigtable.AdminClient, error) {
+	if *bigtableEmulatorHost != "" {
+		os.Setenv("BIGTABLE_EMULATOR_HOST", *bigtableEmulatorHost)
+		return bigtable.NewAdminClient(ctx, projectID, instanceID)
+	}
+	return bigtable.NewAdminClient(ctx, projectID, instanceID, opts...)
+}
+
+// Emulated reports whether Datastore and GCS are both served by emulators.
+func Emulated() bool {
+	return *datastoreEmulatorHost != "" && *storageEmulatorHost != ""
+}
+
+// ResultsURL rewrites a public GCS URL (such as a TestRun's RawResultsURL) to
+// point at the GCS emulator, if one is configured, so that it can be fetched
+// over plain HTTP.
+func ResultsURL(url string) string {
+	if *storageEmulatorHost == "" || !strings.HasPrefix(url, gcsPrefix) {
+		return url
+	}
+	return storageEmulatorURL() + strings.TrimPrefix(url, gcsPrefix)
+}
+
+func storageEmulatorURL() string {
+	host := strings.TrimSuffix(*storageEmulatorHost, "/")
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return host + "/"
+}
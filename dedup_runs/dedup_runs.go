@@ -6,24 +6,33 @@ import (
 	"fmt"
 
 	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/productspec"
+	"github.com/web-platform-tests/data-migration/profile"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 	"google.golang.org/api/iterator"
 )
 
 var (
 	projectID = flag.String("project", "wptdashboard-staging", "Google Cloud project")
+	runFilter productspec.ProductSpecs
 )
 
+func init() {
+	flag.Var(&runFilter, "runs", productspec.Usage)
+}
+
 func print(run *shared.TestRun) {
 	fmt.Printf("%d %s-%s %s-%s %s\n", run.ID, run.BrowserName, run.BrowserVersion, run.OSName, run.OSVersion, run.ResultsURL)
 }
 
 func main() {
 	flag.Parse()
+	profile.Apply(map[string]string{"project": "project"})
 
 	ctx := context.Background()
 
-	dsClient, err := datastore.NewClient(ctx, *projectID)
+	dsClient, err := clients.NewDatastore(ctx, *projectID)
 	if err != nil {
 		panic(err)
 	}
@@ -32,6 +41,10 @@ func main() {
 
 	var lastRun shared.TestRun
 	var printedFirst bool
+	// Duplicates are collected first, so that the write guard (and its
+	// snapshot) runs before anything is deleted, and only if needed.
+	var duplicateKeys []*datastore.Key
+	var duplicates []shared.TestRun
 
 	for t := dsClient.Run(ctx, query); ; {
 		key, err := t.Next(nil)
@@ -48,6 +61,9 @@ func main() {
 		if run.RawResultsURL == "" {
 			break
 		}
+		if !runFilter.Matches(&run) {
+			continue
+		}
 
 		if run.RawResultsURL == lastRun.RawResultsURL {
 			if !printedFirst {
@@ -55,13 +71,24 @@ func main() {
 				printedFirst = true
 				print(&lastRun)
 			}
-			fmt.Printf("Deleting: ")
+			fmt.Printf("Duplicate: ")
 			print(&run)
-			dsClient.Delete(ctx, key)
+			duplicateKeys = append(duplicateKeys, key)
+			duplicates = append(duplicates, run)
 		} else {
 			printedFirst = false
 		}
 
 		lastRun = run
 	}
+
+	if len(duplicateKeys) == 0 {
+		return
+	}
+	profile.GuardWrite(*projectID)
+	for i, key := range duplicateKeys {
+		fmt.Printf("Deleting: ")
+		print(&duplicates[i])
+		dsClient.Delete(ctx, key)
+	}
 }
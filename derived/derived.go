@@ -0,0 +1,171 @@
+package derived
+
+import (
+	"strings"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	git "gopkg.in/src-d/go-git.v4"
+
+	"github.com/web-platform-tests/data-migration/channel"
+	"github.com/web-platform-tests/data-migration/ci"
+	"github.com/web-platform-tests/data-migration/wptgit"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// Labels that are derived from a run's metadata, besides browser names and
+// CI sources.
+const (
+	Experimental = "experimental"
+	Master       = "master"
+)
+
+// channelLabels are the channel labels, including the legacy "release" label
+// (which is replaced by "stable").
+var channelLabels = []string{
+	channel.Stable, "release", channel.Beta, channel.Dev, channel.Canary, channel.Nightly, channel.Preview,
+}
+
+// MasterRevisions identifies the runs of revisions on master.
+type MasterRevisions struct {
+	// Revisions resolves (possibly abbreviated) revisions of any commit.
+	Revisions *wptgit.Index
+	// SHAs contains the full hashes of the first-parent history of master,
+	// i.e. the commits that master actually pointed at.
+	SHAs mapset.Set
+}
+
+// LoadMasterRevisions indexes the commits of the repository and its master
+// history.
+func LoadMasterRevisions(repo *git.Repository) (*MasterRevisions, error) {
+	history, err := wptgit.MasterHistory(repo)
+	if err != nil {
+		return nil, err
+	}
+	shas := mapset.NewSet()
+	for _, commit := range history {
+		shas.Add(commit.Hash)
+	}
+	revisions, err := wptgit.IndexAllCommits(repo)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterRevisions{Revisions: revisions, SHAs: shas}, nil
+}
+
+// IsMasterRun reports whether the run looks like a full run of a master
+// revision by a CI system. Due to missing data in older runs, it uses a few
+// heuristics: runs of PRs are labelled pr_base or pr_head, and full runs take
+// more than ten minutes.
+func (m *MasterRevisions) IsMasterRun(run *shared.TestRun) bool {
+	return ci.HasSourceLabel(run) && m.isMasterCandidate(run)
+}
+
+// isMasterCandidate applies the heuristics of IsMasterRun, except for the CI
+// source.
+func (m *MasterRevisions) isMasterCandidate(run *shared.TestRun) bool {
+	labels := run.LabelsSet()
+	if labels.Contains("pr_base") || labels.Contains("pr_head") {
+		return false
+	}
+	if run.TimeEnd.Sub(run.TimeStart) <= time.Minute*10 {
+		return false
+	}
+	revision := run.FullRevisionHash
+	if revision == "" {
+		revision = run.Revision
+	}
+	hash, err := m.Revisions.Resolve(revision)
+	if err != nil {
+		return false
+	}
+	return m.SHAs.Contains(hash)
+}
+
+// Canonical returns the canonical labels of the run: the labels derived from
+// its metadata (browser name, channel, stable/experimental, master and CI
+// source), in that order, after its other labels (in their original order).
+//
+// Each family of derived labels replaces the run's labels of that family only
+// if it can be derived; otherwise the run's labels of that family are kept.
+// The master label is only ever added (its absence cannot be derived), and
+// only if master is non-nil. The CI source is derived from the run's URLs
+// alone, and only with high confidence.
+func Canonical(run *shared.TestRun, master *MasterRevisions) []string {
+	families := make([][]string, 0)
+	derived := make([]string, 0)
+	derive := func(family []string, labels ...string) {
+		families = append(families, family)
+		derived = append(derived, labels...)
+	}
+
+	// Browser name.
+	browser := strings.TrimSuffix(run.BrowserName, "-experimental")
+	isExperimental := strings.HasSuffix(run.BrowserName, "-experimental")
+	if shared.IsBrowserName(run.BrowserName) {
+		names := make([]string, 0)
+		for _, label := range run.Labels {
+			if shared.IsStableBrowserName(label) {
+				names = append(names, label)
+			}
+		}
+		derive(append(names, browser), browser)
+	}
+
+	// Channel, and stable/experimental. An -experimental browser name takes
+	// precedence over a stable version, whose channel is then unknown.
+	if c, ok := channel.Infer(run.BrowserName, run.BrowserVersion); ok && !(isExperimental && c == channel.Stable) {
+		derive(channelLabels, c)
+		if isExperimental || channel.IsExperimental(c) {
+			derive([]string{Experimental}, Experimental)
+		} else {
+			derive([]string{Experimental})
+		}
+	} else if isExperimental {
+		derive([]string{channel.Stable, "release", Experimental}, Experimental)
+	}
+
+	// Master, and CI source.
+	source := ci.Classify(run, nil)
+	hasSource := source.Confidence == ci.High || ci.HasSourceLabel(run)
+	if master != nil && hasSource && master.isMasterCandidate(run) {
+		derive([]string{Master}, Master)
+	}
+	if source.Confidence == ci.High {
+		derive(ci.Sources, source.Source)
+	}
+
+	managed := mapset.NewSet()
+	for _, family := range families {
+		for _, label := range family {
+			managed.Add(label)
+		}
+	}
+	canonical := make([]string, 0, len(run.Labels)+len(derived))
+	seen := mapset.NewSet()
+	for _, label := range run.Labels {
+		if !managed.Contains(label) && seen.Add(label) {
+			canonical = append(canonical, label)
+		}
+	}
+	for _, label := range derived {
+		if seen.Add(label) {
+			canonical = append(canonical, label)
+		}
+	}
+	return canonical
+}
+
+// SameSet reports whether two label lists contain the same labels, ignoring
+// order and duplicates.
+func SameSet(a, b []string) bool {
+	return toSet(a).Equal(toSet(b))
+}
+
+func toSet(labels []string) mapset.Set {
+	set := mapset.NewSet()
+	for _, label := range labels {
+		set.Add(label)
+	}
+	return set
+}
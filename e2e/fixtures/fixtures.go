@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/results-analysis/metrics"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	mode       = flag.String("mode", "seed", "seed: populate the emulators with fixtures; verify: check the fixtures after running the migrations")
+	projectID  = flag.String("project", "wptdashboard-local", "Google Cloud project")
+	bucketName = flag.String("bucket", "wptd-results-local", "GCS bucket for raw reports")
+	btInstance = flag.String("bt_instance", "wpt-results-matrix", "Bigtable instance")
+	btTable    = flag.String("bt_table", "wpt-results", "Bigtable table")
+	btFamily   = flag.String("bt_family", "tests", "Bigtable column family")
+)
+
+const gcsPrefix = "https://storage.googleapis.com/"
+
+// fixture is a TestRun seeded under a fixed ID, with a raw report at
+// reportPath (relative to the bucket).
+type fixture struct {
+	id         int64
+	run        shared.TestRun
+	reportPath string
+	// migrated marks reports that add_run_info should rewrite.
+	migrated bool
+}
+
+var created = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func product(browser, version, os, osVersion string) shared.ProductAtRevision {
+	return shared.ProductAtRevision{
+		Product: shared.Product{
+			BrowserName:    browser,
+			BrowserVersion: version,
+			OSName:         os,
+			OSVersion:      osVersion,
+		},
+		Revision:         "abcdef0123",
+		FullRevisionHash: "abcdef0123456789abcdef0123456789abcdef01",
+	}
+}
+
+func fixtures() []fixture {
+	return []fixture{
+		{
+			id: 1,
+			run: shared.TestRun{
+				ProductAtRevision: product("chrome", "70.0.3538.9 dev", "linux", "4.4"),
+				CreatedAt:         created,
+			},
+			reportPath: "abcdef0123/chrome-70.0.3538.9_dev-linux-4.4/report.json",
+		},
+		{
+			id: 2,
+			run: shared.TestRun{
+				ProductAtRevision: product("firefox", "64.0a1", "linux", "4.4"),
+				CreatedAt:         created,
+				TimeStart:         created.Add(-time.Hour),
+				TimeEnd:           created.Add(-time.Minute),
+				Labels:            []string{"firefox"},
+			},
+			reportPath: "abcdef0123/firefox-64.0a1-linux-4.4/report.json",
+		},
+		{
+			// Duplicate of 2, to be removed by dedup_runs.
+			id: 3,
+			run: shared.TestRun{
+				ProductAtRevision: product("firefox", "64.0a1", "linux", "4.4"),
+				CreatedAt:         created.Add(time.Minute),
+				TimeStart:         created.Add(-time.Hour),
+				TimeEnd:           created.Add(-time.Minute),
+				Labels:            []string{"firefox"},
+			},
+			reportPath: "abcdef0123/firefox-64.0a1-linux-4.4/report.json",
+		},
+		{
+			id: 4,
+			run: shared.TestRun{
+				ProductAtRevision: product("edge", "17", "windows", "10"),
+				CreatedAt:         created,
+				TimeStart:         created.Add(-time.Hour),
+				TimeEnd:           created.Add(-time.Minute),
+			},
+			reportPath: "abcdef0123/edge_17_windows_10/report.json",
+			migrated:   true,
+		},
+		{
+			// Unnormalized version and stale major label, for tagger/versions.go.
+			id: 5,
+			run: shared.TestRun{
+				ProductAtRevision: product("chrome", "71.0.3578.98 Stable", "linux", "4.4"),
+				CreatedAt:         created,
+				TimeStart:         created.Add(-time.Hour),
+				TimeEnd:           created.Add(-time.Minute),
+				Labels:            []string{"major:70"},
+			},
+			reportPath: "abcdef0123/chrome-71.0.3578.98_stable-linux-4.4/report.json",
+		},
+	}
+}
+
+func report(run shared.TestRun) metrics.TestResultsReport {
+	return metrics.TestResultsReport{
+		Results: []*metrics.TestResults{
+			{
+				Test:   "/2dcontext/fill.html",
+				Status: "OK",
+				Subtests: []metrics.SubTest{
+					{Name: "fill", Status: "PASS"},
+					{Name: "fill rect", Status: "FAIL"},
+				},
+			},
+			{
+				Test:   "/dom/historical.html",
+				Status: "PASS",
+			},
+		},
+		RunInfo: metrics.RunInfo{
+			ProductAtRevision: run.ProductAtRevision,
+		},
+	}
+}
+
+func writeObject(ctx context.Context, bucket *storage.BucketHandle, path string, data []byte) {
+	w := bucket.Object(path).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func seed(ctx context.Context, ds *datastore.Client, gcs *storage.Client) {
+	bucket := gcs.Bucket(*bucketName)
+	if err := bucket.Create(ctx, *projectID, nil); err != nil {
+		log.Printf("Bucket %s not created (may already exist): %v", *bucketName, err)
+	}
+	for _, f := range fixtures() {
+		f.run.RawResultsURL = gcsPrefix + *bucketName + "/" + f.reportPath
+		key := datastore.IDKey("TestRun", f.id, nil)
+		if _, err := ds.Put(ctx, key, &f.run); err != nil {
+			log.Fatal(err)
+		}
+		data, err := json.Marshal(report(f.run))
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeObject(ctx, bucket, f.reportPath, data)
+		if f.migrated {
+			logPath := strings.TrimSuffix(f.reportPath, "report.json") + "migration.log"
+			writeObject(ctx, bucket, logPath, []byte("migrated\n"))
+		}
+		log.Printf("Seeded TestRun %d (%s %s)", f.id, f.run.BrowserName, f.run.BrowserVersion)
+	}
+
+	admin, err := clients.NewBigtableAdmin(ctx, *projectID, *btInstance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := admin.CreateTable(ctx, *btTable); err != nil {
+		log.Printf("Table %s not created (may already exist): %v", *btTable, err)
+	}
+	if err := admin.CreateColumnFamily(ctx, *btTable, *btFamily); err != nil {
+		log.Printf("Column family %s not created (may already exist): %v", *btFamily, err)
+	}
+}
+
+type verifier struct {
+	failures []string
+}
+
+func (v *verifier) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.failures = append(v.failures, fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *verifier) labels(id int64, run *shared.TestRun, want, unwanted []string) {
+	labels := mapset.NewSet()
+	for _, l := range run.Labels {
+		labels.Add(l)
+	}
+	for _, l := range want {
+		v.check(labels.Contains(l), "TestRun %d: missing label %s (labels %v)", id, l, run.Labels)
+	}
+	for _, l := range unwanted {
+		v.check(!labels.Contains(l), "TestRun %d: unexpected label %s (labels %v)", id, l, run.Labels)
+	}
+}
+
+func verify(ctx context.Context, ds *datastore.Client, gcs *storage.Client, bt *bigtable.Client) {
+	var v verifier
+	runs := make(map[int64]*shared.TestRun)
+	for _, f := range fixtures() {
+		var run shared.TestRun
+		err := ds.Get(ctx, datastore.IDKey("TestRun", f.id, nil), &run)
+		if err == datastore.ErrNoSuchEntity {
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		runs[f.id] = &run
+	}
+
+	// tagger/browser_name.go, tagger/channels.go, tagger/stable.go and
+	// tagger/experimental.go
+	if run, ok := runs[1]; ok {
+		v.labels(1, run, []string{"chrome", "dev", "experimental"}, []string{"stable"})
+		// add_time_start: the report has no time_start or time_end.
+		v.check(run.TimeStart.Equal(run.CreatedAt), "TestRun 1: TimeStart %v not backfilled from CreatedAt", run.TimeStart)
+		v.check(run.TimeEnd.Equal(run.CreatedAt), "TestRun 1: TimeEnd %v not backfilled from CreatedAt", run.TimeEnd)
+		v.labels(1, run, []string{"time-estimated"}, nil)
+	} else {
+		v.check(false, "TestRun 1 is missing")
+	}
+	for _, id := range []int64{2, 3} {
+		if run, ok := runs[id]; ok {
+			v.labels(id, run, []string{"firefox", "nightly", "experimental"}, []string{"stable"})
+		}
+	}
+	if run, ok := runs[4]; ok {
+		v.labels(4, run, []string{"edge", "stable"}, []string{"experimental"})
+		// add_run_info
+		newPath := "abcdef0123/edge-17-windows-10/report.json"
+		v.check(run.RawResultsURL == gcsPrefix+*bucketName+"/"+newPath, "TestRun 4: RawResultsURL %s not migrated", run.RawResultsURL)
+		_, err := gcs.Bucket(*bucketName).Object(newPath).Attrs(ctx)
+		v.check(err == nil, "Migrated report %s missing: %v", newPath, err)
+	} else {
+		v.check(false, "TestRun 4 is missing")
+	}
+
+	// tagger/versions.go
+	if run, ok := runs[1]; ok {
+		v.check(run.BrowserVersion == "70.0.3538.9 dev", "TestRun 1: BrowserVersion %q rewritten", run.BrowserVersion)
+		v.labels(1, run, []string{"major:70"}, nil)
+	}
+	if run, ok := runs[5]; ok {
+		v.check(run.BrowserVersion == "71.0.3578.98 stable", "TestRun 5: BrowserVersion %q not normalized", run.BrowserVersion)
+		v.labels(5, run, []string{"chrome", "stable", "major:71"}, []string{"experimental", "major:70"})
+	} else {
+		v.check(false, "TestRun 5 is missing")
+	}
+
+	// dedup_runs
+	_, has2 := runs[2]
+	_, has3 := runs[3]
+	v.check(has2 != has3, "Expected exactly one of the duplicate TestRuns 2 and 3, found %v and %v", has2, has3)
+
+	// grid/load/bigtable
+	rows := 0
+	err := bt.Open(*btTable).ReadRows(ctx, bigtable.PrefixRange("chrome-"), func(r bigtable.Row) bool {
+		rows++
+		return true
+	})
+	v.check(err == nil && rows > 0, "No Bigtable rows for chrome (err: %v)", err)
+
+	for _, f := range v.failures {
+		log.Printf("FAIL: %s", f)
+	}
+	if len(v.failures) > 0 {
+		log.Fatalf("%d check(s) failed", len(v.failures))
+	}
+	log.Printf("All checks passed")
+}
+
+func main() {
+	flag.Parse()
+	profile.Apply(map[string]string{
+		"project":     "project",
+		"bucket":      "results_bucket",
+		"bt_instance": "bigtable_instance",
+	})
+
+	ctx := context.Background()
+	ds, err := clients.NewDatastore(ctx, *projectID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gcs, err := clients.NewStorage(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *mode {
+	case "seed":
+		seed(ctx, ds, gcs)
+	case "verify":
+		bt, err := clients.NewBigtable(ctx, *projectID, *btInstance)
+		if err != nil {
+			log.Fatal(err)
+		}
+		verify(ctx, ds, gcs, bt)
+	default:
+		log.Fatalf("Unknown mode: %s", *mode)
+	}
+}
@@ -0,0 +1,74 @@
+#!/bin/bash
+# End-to-end test: seeds local emulators with fixtures, runs every migration
+# against them (using the "local" profile) and verifies the result.
+#
+# Requires the Cloud SDK emulators (`gcloud components install
+# cloud-datastore-emulator bigtable`) and docker for fake-gcs-server.
+#
+# tagger/master.go and unshard/ are not covered, as they need a wpt checkout.
+
+set -euo pipefail
+
+cd "$(dirname "$0")/.."
+
+PROJECT=wptdashboard-local
+DATASTORE_PORT=8081
+STORAGE_PORT=4443
+BIGTABLE_PORT=8086
+WORK_DIR="$(mktemp -d)"
+PIDS=()
+
+function cleanup() {
+  for pid in "${PIDS[@]}"; do
+    pkill -P "${pid}" || true
+    kill "${pid}" || true
+  done
+  docker rm -f e2e-fake-gcs > /dev/null 2>&1 || true
+  rm -rf "${WORK_DIR}"
+}
+trap cleanup EXIT
+
+function wait_for() {
+  for i in $(seq 1 60); do
+    if curl -s "http://localhost:$1" > /dev/null; then
+      return
+    fi
+    sleep 1
+  done
+  echo "Timed out waiting for localhost:$1"
+  exit 1
+}
+
+gcloud beta emulators datastore start --project="${PROJECT}" \
+  --host-port="localhost:${DATASTORE_PORT}" --no-store-on-disk \
+  --consistency=1.0 > "${WORK_DIR}/datastore.log" 2>&1 &
+PIDS+=($!)
+gcloud beta emulators bigtable start \
+  --host-port="localhost:${BIGTABLE_PORT}" > "${WORK_DIR}/bigtable.log" 2>&1 &
+PIDS+=($!)
+docker run -d --rm --name e2e-fake-gcs -p "${STORAGE_PORT}:4443" \
+  fsouza/fake-gcs-server -scheme http -public-host "localhost:${STORAGE_PORT}" > /dev/null
+
+wait_for "${DATASTORE_PORT}"
+wait_for "${STORAGE_PORT}/storage/v1/b"
+sleep 5 # The Bigtable emulator speaks gRPC only.
+
+function run() {
+  echo "=== $*"
+  go run "$@" --profile=local
+}
+
+run e2e/fixtures/fixtures.go --mode=seed
+
+run tagger/browser_name.go
+run tagger/channels.go
+run tagger/stable.go
+run tagger/experimental.go
+run tagger/versions.go
+run dedup_runs/dedup_runs.go
+run add_time_start/add_time_start.go
+run add_run_info/add_run_info.go
+(cd "${WORK_DIR}" && run "${OLDPWD}/grid/load/load_data.go" && test -s runs.json)
+run grid/load/bigtable/load_data.go
+
+run e2e/fixtures/fixtures.go --mode=verify
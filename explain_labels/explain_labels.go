@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/data-migration/provenance"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	projectID = flag.String("project", "wptdashboard-staging", "Google Cloud project")
+	runID     = flag.Int64("run-id", 0, "ID of the TestRun to explain")
+	history   = flag.Bool("history", false, "Also print all label events of the run, including removals")
+)
+
+func main() {
+	flag.Parse()
+	profile.Apply(map[string]string{"project": "project"})
+	if *runID == 0 {
+		log.Fatal("--run-id is required")
+	}
+
+	ctx := context.Background()
+	dsClient, err := clients.NewDatastore(ctx, *projectID)
+	if err != nil {
+		panic(err)
+	}
+
+	key := datastore.IDKey("TestRun", *runID, nil)
+	var run shared.TestRun
+	if err := dsClient.Get(ctx, key, &run); err != nil {
+		log.Fatalf("Failed to load TestRun %d: %s", *runID, err.Error())
+	}
+	var h provenance.History
+	if err := dsClient.Get(ctx, provenance.Key(key), &h); err != nil && err != datastore.ErrNoSuchEntity {
+		log.Fatalf("Failed to load the label provenance of TestRun %d: %s", *runID, err.Error())
+	}
+
+	fmt.Printf("TestRun %d (%s %s, created %v)\n", *runID, run.BrowserName, run.BrowserVersion, run.CreatedAt)
+	explanations := h.Explain(run.Labels)
+	for _, label := range run.Labels {
+		e := explanations[label]
+		if e.Time.IsZero() {
+			fmt.Printf("  %s: %s\n", label, e.Source)
+		} else {
+			fmt.Printf("  %s: %s by %s at %v\n", label, e.Action, e.Source, e.Time)
+		}
+	}
+	if changes := h.Changes(); len(changes) > 0 {
+		fmt.Println("Field changes:")
+		for _, e := range changes {
+			fmt.Printf("  %s: %q -> %q by %s at %v\n", e.Field, e.From, e.To, e.Source, e.Time)
+		}
+	}
+	if *history {
+		fmt.Println("History:")
+		for _, e := range h.Events {
+			if e.Action == provenance.Changed {
+				fmt.Printf("  %v %s %s %q -> %q by %s\n", e.Time, e.Action, e.Field, e.From, e.To, e.Source)
+			} else {
+				fmt.Printf("  %v %s %s by %s\n", e.Time, e.Action, e.Label, e.Source)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	tolerance      = flag.Duration("tolerance", 5*time.Minute, "Clock skew tolerated between TimeStart, TimeEnd, CreatedAt and now")
+	maxUploadDelay = flag.Duration("max-upload-delay", 30*time.Minute, "Longest plausible time between the end of a run and its upload (CreatedAt)")
+	offsetStep     = flag.Duration("offset-step", time.Hour, "Granularity of the timezone offsets detected; it must exceed --max-upload-delay plus --tolerance for offsets to be unambiguous")
+	maxShift       = flag.Duration("max-shift", maxTimezoneOffset, "Largest offset by which times after CreatedAt are shifted back; larger offsets are not timezone bugs, and are reported for manual review")
+	shiftEarly     = flag.Bool("shift-early", false, "Also shift times more than --max-upload-delay before CreatedAt forward (by at most 12 hours), which may also be late uploads")
+)
+
+// The largest positive and negative UTC offsets, i.e. the largest shifts of
+// times recorded after and before their upload.
+const (
+	maxTimezoneOffset = 14 * time.Hour
+	maxEarlyShift     = 12 * time.Hour
+)
+
+// Classes of timestamp anomalies.
+const (
+	// Zero TimeStart or TimeEnd; add_time_start backfills them.
+	zeroTime = "zero_time"
+	// TimeEnd before TimeStart; fixed by swapping them.
+	swapped = "swapped"
+	// TimeStart or TimeEnd after now.
+	future = "future"
+	// TimeEnd after CreatedAt, i.e. the run ended after its results were
+	// uploaded; fixed by shifting both times back by the detected offset.
+	afterUpload = "after_upload"
+	// TimeEnd more than --max-upload-delay before CreatedAt; with
+	// --shift-early, fixed by shifting both times forward by the detected
+	// offset.
+	beforeUpload = "before_upload"
+)
+
+// anomaly is the audit record of a run with implausible timestamps.
+type anomaly struct {
+	ID            int64     `json:"id"`
+	Product       string    `json:"product"`
+	RawResultsURL string    `json:"raw_results_url,omitempty"`
+	Classes       []string  `json:"classes"`
+	TimeStart     time.Time `json:"time_start"`
+	TimeEnd       time.Time `json:"time_end"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Fixes lists the fixes applied, e.g. "swapped" or "shifted -2h0m0s".
+	Fixes      []string   `json:"fixes,omitempty"`
+	FixedStart *time.Time `json:"fixed_time_start,omitempty"`
+	FixedEnd   *time.Time `json:"fixed_time_end,omitempty"`
+	Unresolved bool       `json:"unresolved"`
+	Reason     string     `json:"reason,omitempty"`
+	// Manual is set if the detected offset is larger than any timezone
+	// offset, so that a shift by it (only applied with a larger --max-shift)
+	// needs a manual decision.
+	Manual bool `json:"manual,omitempty"`
+}
+
+// detectOffset returns the offset by which end is off, as the only whole
+// multiple of --offset-step that puts end between --tolerance after and
+// --max-upload-delay before createdAt once subtracted. ok is false if no
+// multiple (or more than one) does, i.e. the gap is not a consistent whole
+// offset plus a plausible upload delay.
+func detectOffset(end, createdAt time.Time) (offset time.Duration, ok bool) {
+	gap := end.Sub(createdAt)
+	lo := math.Ceil(float64(gap-*tolerance) / float64(*offsetStep))
+	hi := math.Floor(float64(gap+*maxUploadDelay) / float64(*offsetStep))
+	if lo != hi || lo == 0 {
+		return 0, false
+	}
+	return time.Duration(lo) * *offsetStep, true
+}
+
+// check classifies the run's timestamp anomalies and computes the fixed
+// TimeStart and TimeEnd, as far as they are mechanically fixable:
+//
+//   - TimeEnd before TimeStart: the fields are swapped.
+//   - TimeEnd after CreatedAt (and possibly in the future) or, with
+//     --shift-early, more than --max-upload-delay before it: both fields are
+//     shifted by the detected whole offset (see detectOffset), as timezone
+//     bugs produce local times mislabelled as UTC, up to --max-shift (14
+//     hours) back or 12 hours forward.
+//
+// Zero times, gaps that are not a whole offset, larger shifts and times still
+// in the future after shifting are left for manual review.
+func check(run *shared.TestRun, now time.Time) *anomaly {
+	a := &anomaly{
+		ID:            run.ID,
+		Product:       run.BrowserName + "-" + run.BrowserVersion,
+		RawResultsURL: run.RawResultsURL,
+		Classes:       make([]string, 0),
+		TimeStart:     run.TimeStart,
+		TimeEnd:       run.TimeEnd,
+		CreatedAt:     run.CreatedAt,
+	}
+	if run.TimeStart.IsZero() || run.TimeEnd.IsZero() {
+		a.Classes = append(a.Classes, zeroTime)
+		a.Unresolved = true
+		a.Reason = "Missing TimeStart or TimeEnd; run add_time_start to backfill it"
+		return a
+	}
+
+	start, end := run.TimeStart, run.TimeEnd
+	if end.Add(*tolerance).Before(start) {
+		a.Classes = append(a.Classes, swapped)
+		start, end = end, start
+		a.Fixes = append(a.Fixes, swapped)
+	}
+	isFuture := start.After(now.Add(*tolerance)) || end.After(now.Add(*tolerance))
+	if isFuture {
+		a.Classes = append(a.Classes, future)
+	}
+	if run.CreatedAt.IsZero() {
+		if isFuture {
+			a.Unresolved = true
+			a.Reason = "TestRun has no CreatedAt to compare the future times with"
+		}
+	} else if delay := run.CreatedAt.Sub(end); delay < -*tolerance || delay > *maxUploadDelay {
+		limit := *maxShift
+		if delay < 0 {
+			a.Classes = append(a.Classes, afterUpload)
+		} else {
+			a.Classes = append(a.Classes, beforeUpload)
+			limit = maxEarlyShift
+		}
+		offset, ok := detectOffset(end, run.CreatedAt)
+		a.Manual = ok && (offset > maxTimezoneOffset || -offset > maxTimezoneOffset)
+		switch {
+		case delay > 0 && !*shiftEarly:
+			a.Unresolved = true
+			a.Reason = "TimeEnd is " + delay.String() + " before CreatedAt, which may be a timezone offset or a late upload; rerun with --shift-early to shift it"
+		case !ok:
+			a.Unresolved = true
+			a.Reason = "TimeEnd minus CreatedAt is " + (-delay).String() + ", which is not a whole multiple of --offset-step plus an upload delay"
+		case offset > limit || -offset > limit:
+			a.Unresolved = true
+			a.Reason = "TimeEnd is off by " + offset.String() + ", more than the largest shift"
+		default:
+			start, end = start.Add(-offset), end.Add(-offset)
+			if offset > 0 {
+				a.Fixes = append(a.Fixes, "shifted -"+offset.String())
+			} else {
+				a.Fixes = append(a.Fixes, "shifted +"+(-offset).String())
+			}
+			if start.After(now.Add(*tolerance)) || end.After(now.Add(*tolerance)) {
+				a.Unresolved = true
+				a.Reason = "TimeStart or TimeEnd is still in the future after shifting by " + offset.String()
+			}
+		}
+	}
+
+	if len(a.Classes) == 0 {
+		return nil
+	}
+	if len(a.Fixes) == 0 && !a.Unresolved {
+		a.Unresolved = true
+		a.Reason = "No mechanical fix applies"
+	}
+	if !a.Unresolved {
+		a.FixedStart, a.FixedEnd = &start, &end
+	}
+	return a
+}
+
+// timestampFixer fixes the mechanically fixable timestamp anomalies of runs,
+// and reports the rest.
+type timestampFixer struct {
+	Now time.Time
+
+	mutex     *sync.Mutex
+	anomalies map[int64]*anomaly
+}
+
+func (f timestampFixer) ShouldProcessRun(run *shared.TestRun) bool {
+	a := check(run, f.Now)
+	if a == nil {
+		return false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.anomalies[run.ID] = a
+	return a.FixedStart != nil
+}
+
+func (f timestampFixer) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	a := check(run, f.Now)
+	if a == nil || a.FixedStart == nil {
+		return processor.ConditionUnsatisfied{}
+	}
+	log.Printf("TestRun %d (%v): TimeStart %v -> %v, TimeEnd %v -> %v", run.ID, a.Fixes, run.TimeStart, *a.FixedStart, run.TimeEnd, *a.FixedEnd)
+	run.TimeStart = *a.FixedStart
+	run.TimeEnd = *a.FixedEnd
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report counts the runs with each class of anomaly, and lists the fixed and
+// the unresolved runs (which need a manual decision), and the IDs of the runs
+// off by more than any timezone offset (which do too, even if fixed).
+func (f timestampFixer) Report() interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	counts := make(map[string]int)
+	fixed := make([]*anomaly, 0)
+	unresolved := make([]*anomaly, 0)
+	manual := make([]int64, 0)
+	for _, a := range f.anomalies {
+		for _, class := range a.Classes {
+			counts[class]++
+		}
+		if a.Unresolved {
+			unresolved = append(unresolved, a)
+		} else {
+			fixed = append(fixed, a)
+		}
+		if a.Manual {
+			manual = append(manual, a.ID)
+		}
+	}
+	return map[string]interface{}{
+		"counts":     counts,
+		"fixed":      fixed,
+		"unresolved": unresolved,
+		"manual":     manual,
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *offsetStep <= *maxUploadDelay+*tolerance {
+		log.Fatalf("--offset-step must exceed --max-upload-delay plus --tolerance")
+	}
+	processor.MigrateData(timestampFixer{
+		Now:       time.Now(),
+		mutex:     &sync.Mutex{},
+		anomalies: make(map[int64]*anomaly),
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+func TestCheck(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	now := at("2019-01-20T00:00:00Z")
+
+	tests := []struct {
+		name       string
+		start, end string
+		createdAt  string
+		shiftEarly bool
+		classes    []string // nil if no anomaly is expected
+		unresolved bool
+		manual     bool
+		fixedStart string
+		fixedEnd   string
+	}{
+		{
+			name:  "plausible",
+			start: "2019-01-10T10:00:00Z", end: "2019-01-10T11:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+		},
+		{
+			name:  "zero",
+			start: "", end: "2019-01-10T11:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes: []string{zeroTime}, unresolved: true,
+		},
+		{
+			name:  "swap",
+			start: "2019-01-10T11:00:00Z", end: "2019-01-10T10:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes:    []string{swapped},
+			fixedStart: "2019-01-10T10:00:00Z", fixedEnd: "2019-01-10T11:00:00Z",
+		},
+		{
+			name:  "shift",
+			start: "2019-01-10T13:00:00Z", end: "2019-01-10T14:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes:    []string{afterUpload},
+			fixedStart: "2019-01-10T10:00:00Z", fixedEnd: "2019-01-10T11:00:00Z",
+		},
+		{
+			name:  "shift by days",
+			start: "2019-01-12T13:00:00Z", end: "2019-01-12T14:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes: []string{afterUpload}, unresolved: true, manual: true,
+		},
+		{
+			name:  "not a whole offset",
+			start: "2019-01-10T13:25:00Z", end: "2019-01-10T14:25:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes: []string{afterUpload}, unresolved: true,
+		},
+		{
+			name:  "over-shift",
+			start: "2019-01-11T02:00:00Z", end: "2019-01-11T03:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes: []string{afterUpload}, unresolved: true, manual: true,
+		},
+		{
+			name:  "largest timezone offset",
+			start: "2019-01-11T00:00:00Z", end: "2019-01-11T01:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes:    []string{afterUpload},
+			fixedStart: "2019-01-10T10:00:00Z", fixedEnd: "2019-01-10T11:00:00Z",
+		},
+		{
+			name:  "future",
+			start: "2019-01-20T01:40:00Z", end: "2019-01-20T02:40:00Z", createdAt: "2019-01-19T23:50:00Z",
+			classes:    []string{future, afterUpload},
+			fixedStart: "2019-01-19T22:40:00Z", fixedEnd: "2019-01-19T23:40:00Z",
+		},
+		{
+			name:  "future without CreatedAt",
+			start: "2019-01-20T02:00:00Z", end: "2019-01-20T03:00:00Z", createdAt: "",
+			classes: []string{future}, unresolved: true,
+		},
+		{
+			name:  "early",
+			start: "2019-01-10T03:00:00Z", end: "2019-01-10T04:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			classes: []string{beforeUpload}, unresolved: true,
+		},
+		{
+			name:  "still in the future after shifting",
+			start: "2019-01-19T21:00:00Z", end: "2019-01-19T22:00:00Z", createdAt: "2019-01-20T05:10:00Z",
+			shiftEarly: true,
+			classes:    []string{beforeUpload}, unresolved: true,
+		},
+		{
+			name:  "early with --shift-early",
+			start: "2019-01-10T03:00:00Z", end: "2019-01-10T04:00:00Z", createdAt: "2019-01-10T11:10:00Z",
+			shiftEarly: true,
+			classes:    []string{beforeUpload},
+			fixedStart: "2019-01-10T10:00:00Z", fixedEnd: "2019-01-10T11:00:00Z",
+		},
+	}
+
+	parse := func(s string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		return at(s)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*shiftEarly = test.shiftEarly
+			defer func() { *shiftEarly = false }()
+
+			run := shared.TestRun{
+				TimeStart: parse(test.start),
+				TimeEnd:   parse(test.end),
+				CreatedAt: parse(test.createdAt),
+			}
+			a := check(&run, now)
+			if test.classes == nil {
+				if a != nil {
+					t.Fatalf("expected no anomaly, got %+v", a)
+				}
+				return
+			}
+			if a == nil {
+				t.Fatalf("expected %v, got no anomaly", test.classes)
+			}
+			if !reflect.DeepEqual(a.Classes, test.classes) {
+				t.Errorf("classes: expected %v, got %v", test.classes, a.Classes)
+			}
+			if a.Manual != test.manual {
+				t.Errorf("manual: expected %v, got %v", test.manual, a.Manual)
+			}
+			if a.Unresolved != test.unresolved {
+				t.Errorf("unresolved: expected %v, got %v (%s)", test.unresolved, a.Unresolved, a.Reason)
+			}
+			if test.unresolved {
+				return
+			}
+			if a.FixedStart == nil || !a.FixedStart.Equal(at(test.fixedStart)) || !a.FixedEnd.Equal(at(test.fixedEnd)) {
+				t.Errorf("expected %s - %s, got %v - %v", test.fixedStart, test.fixedEnd, a.FixedStart, a.FixedEnd)
+			}
+		})
+	}
+}
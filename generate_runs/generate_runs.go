@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/results-analysis/metrics"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	projectID            = flag.String("project", "wptdashboard-local", "Google Cloud project to seed with --upload")
+	bucketName           = flag.String("bucket", "wptd-results-local", "GCS bucket that RawResultsURLs point to (and that --upload writes to)")
+	numRuns              = flag.Int("num-runs", 100, "Number of TestRuns to generate")
+	numTests             = flag.Int("tests", 100, "Number of tests in each report")
+	maxSubtests          = flag.Int("subtests", 5, "Maximum number of subtests per test")
+	seed                 = flag.Int64("seed", 1, "Random seed; the same seed and flags generate the same data")
+	duplicateRate        = flag.Float64("duplicate-rate", 0.05, "Fraction of runs that are duplicated (same RawResultsURL)")
+	missingTimeStartRate = flag.Float64("missing-time-start-rate", 0.1, "Fraction of runs without TimeStart")
+	missingLabelsRate    = flag.Float64("missing-labels-rate", 0.1, "Fraction of runs without any labels")
+	outputDir            = flag.String("output", "", "Write runs.json and the reports to this directory")
+	upload               = flag.Bool("upload", false, "Seed the (emulated) Datastore and GCS with the generated data")
+)
+
+const gcsPrefix = "https://storage.googleapis.com/"
+
+type release struct {
+	version string
+	channel string
+}
+
+type browser struct {
+	name      string
+	os        string
+	osVersion string
+	releases  []release
+}
+
+var browsers = []browser{
+	{"chrome", "linux", "4.4", []release{
+		{"70.0.3538.77", "stable"},
+		{"71.0.3578.30 beta", "beta"},
+		{"72.0.3610.2 dev", "dev"},
+	}},
+	{"firefox", "linux", "4.4", []release{
+		{"63.0", "stable"},
+		{"64.0b5", "beta"},
+		{"65.0a1", "nightly"},
+	}},
+	{"safari", "mac", "10.13", []release{
+		{"12.0", "stable"},
+		{"12.1 (Safari Technology Preview 68)", "preview"},
+	}},
+	{"edge", "windows", "10", []release{
+		{"17", "stable"},
+		{"18", "dev"},
+	}},
+}
+
+var ciSources = []string{"azure", "taskcluster", "buildbot"}
+
+var statuses = []string{"PASS", "PASS", "PASS", "FAIL", "TIMEOUT", "ERROR"}
+var subtestStatuses = []string{"PASS", "PASS", "PASS", "FAIL", "TIMEOUT", "NOTRUN"}
+
+func randomHash(r *rand.Rand) string {
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := 0; i < 40; i++ {
+		b.WriteByte(hex[r.Intn(len(hex))])
+	}
+	return b.String()
+}
+
+func isExperimental(channel string) bool {
+	return channel == "dev" || channel == "nightly" || channel == "preview"
+}
+
+func generateRun(r *rand.Rand, start time.Time, i int) shared.TestRun {
+	b := browsers[r.Intn(len(browsers))]
+	rel := b.releases[r.Intn(len(b.releases))]
+	hash := randomHash(r)
+
+	run := shared.TestRun{
+		ProductAtRevision: shared.ProductAtRevision{
+			Product: shared.Product{
+				BrowserName:    b.name,
+				BrowserVersion: rel.version,
+				OSName:         b.os,
+				OSVersion:      b.osVersion,
+			},
+			Revision:         hash[:10],
+			FullRevisionHash: hash,
+		},
+	}
+	run.TimeStart = start.Add(time.Duration(i) * time.Hour)
+	run.TimeEnd = run.TimeStart.Add(time.Duration(20+r.Intn(100)) * time.Minute)
+	run.CreatedAt = run.TimeEnd.Add(time.Duration(1+r.Intn(30)) * time.Minute)
+
+	run.Labels = []string{b.name, rel.channel}
+	if isExperimental(rel.channel) {
+		run.Labels = append(run.Labels, "experimental")
+	} else if rel.channel == "stable" {
+		run.Labels = append(run.Labels, "stable")
+	}
+	run.Labels = append(run.Labels, ciSources[r.Intn(len(ciSources))])
+	if r.Intn(2) == 0 {
+		run.Labels = append(run.Labels, "master")
+	}
+
+	// Deliberate defects.
+	if r.Float64() < *missingTimeStartRate {
+		run.TimeStart = time.Time{}
+	}
+	if r.Float64() < *missingLabelsRate {
+		run.Labels = nil
+	}
+	return run
+}
+
+func reportPath(run shared.TestRun) string {
+	product := fmt.Sprintf("%s-%s-%s-%s", run.BrowserName, run.BrowserVersion, run.OSName, run.OSVersion)
+	product = strings.Replace(product, " ", "_", -1)
+	return fmt.Sprintf("%s/%s/report.json", run.FullRevisionHash, product)
+}
+
+func generateReport(r *rand.Rand, run shared.TestRun) metrics.TestResultsReport {
+	report := metrics.TestResultsReport{
+		Results: make([]*metrics.TestResults, 0, *numTests),
+		RunInfo: metrics.RunInfo{
+			ProductAtRevision: run.ProductAtRevision,
+		},
+	}
+	for i := 0; i < *numTests; i++ {
+		res := &metrics.TestResults{
+			Test:   fmt.Sprintf("/synthetic/dir%d/test%d.html", i%10, i),
+			Status: statuses[r.Intn(len(statuses))],
+		}
+		if *maxSubtests > 0 {
+			n := r.Intn(*maxSubtests + 1)
+			if n > 0 {
+				res.Status = "OK"
+			}
+			for j := 0; j < n; j++ {
+				res.Subtests = append(res.Subtests, metrics.SubTest{
+					Name:   fmt.Sprintf("subtest %d", j),
+					Status: subtestStatuses[r.Intn(len(subtestStatuses))],
+				})
+			}
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func writeLocal(path string, data interface{}) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, bytes, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeObject(ctx context.Context, bucket *storage.BucketHandle, path string, data interface{}) {
+	w := bucket.Object(path).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		w.CloseWithError(err)
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	flag.Parse()
+	profile.Apply(map[string]string{
+		"project": "project",
+		"bucket":  "results_bucket",
+	})
+	if *outputDir == "" && !*upload {
+		log.Fatal("Nothing to do; pass --output and/or --upload")
+	}
+
+	ctx := context.Background()
+	var ds *datastore.Client
+	var bucket *storage.BucketHandle
+	if *upload {
+		if !clients.Emulated() {
+			log.Fatal("Refusing to seed synthetic data into real Cloud services; configure the emulators (e.g. --profile=local)")
+		}
+		var err error
+		if ds, err = clients.NewDatastore(ctx, *projectID); err != nil {
+			log.Fatal(err)
+		}
+		gcs, err := clients.NewStorage(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bucket = gcs.Bucket(*bucketName)
+		if err := bucket.Create(ctx, *projectID, nil); err != nil {
+			log.Printf("Bucket %s not created (may already exist): %v", *bucketName, err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(*seed))
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	runs := make([]shared.TestRun, 0, *numRuns)
+	for i := 0; i < *numRuns; i++ {
+		run := generateRun(r, start, i)
+		path := reportPath(run)
+		run.RawResultsURL = gcsPrefix + *bucketName + "/" + path
+		run.ResultsURL = gcsPrefix + *bucketName + "/" + strings.TrimSuffix(path, "/report.json") + "-summary.json.gz"
+		report := generateReport(r, run)
+
+		if *outputDir != "" {
+			writeLocal(filepath.Join(*outputDir, *bucketName, path), report)
+		}
+		if *upload {
+			writeObject(ctx, bucket, path, report)
+		}
+		runs = append(runs, run)
+
+		if r.Float64() < *duplicateRate {
+			dup := run
+			dup.Labels = append([]string(nil), run.Labels...)
+			dup.CreatedAt = run.CreatedAt.Add(time.Duration(1+r.Intn(60)) * time.Minute)
+			runs = append(runs, dup)
+		}
+	}
+
+	for i := range runs {
+		if *upload {
+			key, err := ds.Put(ctx, datastore.IncompleteKey("TestRun", nil), &runs[i])
+			if err != nil {
+				log.Fatal(err)
+			}
+			runs[i].ID = key.ID
+		} else {
+			runs[i].ID = int64(i + 1)
+		}
+	}
+	if *outputDir != "" {
+		writeLocal(filepath.Join(*outputDir, "runs.json"), runs)
+	}
+	log.Printf("Generated %d TestRuns (including duplicates)", len(runs))
+}
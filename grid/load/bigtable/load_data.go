@@ -12,6 +12,9 @@ import (
 
 	"cloud.google.com/go/bigtable"
 	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/productspec"
+	"github.com/web-platform-tests/data-migration/profile"
 	"github.com/web-platform-tests/results-analysis/metrics"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 	"golang.org/x/sync/semaphore"
@@ -22,6 +25,7 @@ import (
 var projectID *string
 var inputGcsBucket *string
 var gcpCredentialsFile *string
+var runFilter productspec.ProductSpecs
 var outputBTInstanceID *string
 var outputBTTableID *string
 var outputBTFamily *string
@@ -30,6 +34,7 @@ func init() {
 	projectID = flag.String("project_id", "wptdashboard", "Google Cloud Platform project id")
 	inputGcsBucket = flag.String("input_gcs_bucket", "wptd-results", "Google Cloud Storage bucket where shareded test results are stored")
 	gcpCredentialsFile = flag.String("gcp_credentials_file", "client-secret.json", "Path to credentials file for authenticating against Google Cloud Platform services")
+	flag.Var(&runFilter, "runs", productspec.Usage)
 	outputBTInstanceID = flag.String("output_bt_instance_id", "wpt-results-matrix", "Output BigTable instance ID")
 	outputBTTableID = flag.String("output_bt_table_id", "wpt-results", "Output BigTable table ID")
 	outputBTFamily = flag.String("output_bt_family", "tests", "Output BigTable column family for test results")
@@ -68,6 +73,9 @@ func getRuns(ctx context.Context, client *datastore.Client) ([]*datastore.Key, [
 		if err != nil {
 			log.Fatal(err)
 		}
+		if !runFilter.Matches(&testRun) {
+			continue
+		}
 		keys = append(keys, key)
 		testRuns = append(testRuns, testRun)
 	}
@@ -97,16 +105,23 @@ func resultValue(res *metrics.TestResults, sub *metrics.SubTest) []byte {
 func main() {
 	log.SetFlags(log.LstdFlags | log.Llongfile | log.LUTC)
 	flag.Parse()
+	profile.Apply(map[string]string{
+		"project_id":            "project",
+		"input_gcs_bucket":      "results_bucket",
+		"gcp_credentials_file":  "credentials_file",
+		"output_bt_instance_id": "bigtable_instance",
+	})
+	profile.GuardWrite(*projectID)
 
 	go monitor()
 
 	ctx := context.Background()
-	dsClient, err := datastore.NewClient(ctx, *projectID, option.WithCredentialsFile(*gcpCredentialsFile))
+	dsClient, err := clients.NewDatastore(ctx, *projectID, option.WithCredentialsFile(*gcpCredentialsFile))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	btClient, err := bigtable.NewClient(ctx, *projectID, *outputBTInstanceID, option.WithCredentialsFile(*gcpCredentialsFile))
+	btClient, err := clients.NewBigtable(ctx, *projectID, *outputBTInstanceID, option.WithCredentialsFile(*gcpCredentialsFile))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -120,7 +135,7 @@ func main() {
 			sem.Acquire(ctx, 1)
 			defer sem.Release(1)
 
-			resp, err := http.Get(run.RawResultsURL)
+			resp, err := http.Get(clients.ResultsURL(run.RawResultsURL))
 			if err != nil {
 				log.Printf("WARN: Failed to load raw results from \"%s\" for %v", run.RawResultsURL, run)
 				return
@@ -11,7 +11,10 @@ import (
 	"strconv"
 
 	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/clients"
 	"github.com/web-platform-tests/data-migration/grid"
+	"github.com/web-platform-tests/data-migration/productspec"
+	"github.com/web-platform-tests/data-migration/profile"
 	"github.com/web-platform-tests/results-analysis/metrics"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 	"google.golang.org/api/iterator"
@@ -21,17 +24,16 @@ import (
 var projectID *string
 var inputGcsBucket *string
 var gcpCredentialsFile *string
+var runFilter productspec.ProductSpecs
 
 func init() {
 	projectID = flag.String("project_id", "wptdashboard", "Google Cloud Platform project id")
 	inputGcsBucket = flag.String("input_gcs_bucket", "wptd-results", "Google Cloud Storage bucket where shareded test results are stored")
 	gcpCredentialsFile = flag.String("gcp_credentials_file", "client-secret.json", "Path to credentials file for authenticating against Google Cloud Platform services")
+	flag.Var(&runFilter, "runs", productspec.Usage)
 }
 
 func getRuns(ctx context.Context, client *datastore.Client) ([]*datastore.Key, []shared.TestRun) {
-	log.SetFlags(log.LstdFlags | log.Llongfile | log.LUTC)
-	flag.Parse()
-
 	query := datastore.NewQuery("TestRun").Order("CreatedAt")
 	keys := make([]*datastore.Key, 0)
 	testRuns := make([]shared.TestRun, 0)
@@ -45,6 +47,9 @@ func getRuns(ctx context.Context, client *datastore.Client) ([]*datastore.Key, [
 		if err != nil {
 			log.Fatal(err)
 		}
+		if !runFilter.Matches(&testRun) {
+			continue
+		}
 		keys = append(keys, key)
 		testRuns = append(testRuns, testRun)
 	}
@@ -52,28 +57,36 @@ func getRuns(ctx context.Context, client *datastore.Client) ([]*datastore.Key, [
 }
 
 func main() {
+	log.SetFlags(log.LstdFlags | log.Llongfile | log.LUTC)
+	flag.Parse()
+	profile.Apply(map[string]string{
+		"project_id":           "project",
+		"input_gcs_bucket":     "results_bucket",
+		"gcp_credentials_file": "credentials_file",
+	})
+
 	ctx := context.Background()
-	client, err := datastore.NewClient(ctx, *projectID, option.WithCredentialsFile(*gcpCredentialsFile))
+	client, err := clients.NewDatastore(ctx, *projectID, option.WithCredentialsFile(*gcpCredentialsFile))
 	if err != nil {
 		log.Fatal(err)
 	}
-	nextRunID := 0
-	nextTestID := 0
-	testMap := make(map[string]int)
+	nextRunID := int32(0)
+	nextTestID := int32(0)
+	testMap := make(map[string]int32)
 	runSlice := make([]grid.Run, 0)
 	testSlice := make([]grid.Test, 0)
 	testsToRuns := make(map[string]map[string]metrics.CompleteTestStatus)
 	runsToTests := make(map[string]map[string]metrics.CompleteTestStatus)
 	_, runs := getRuns(ctx, client)
 	for _, run := range runs {
-		runID := strconv.Itoa(nextRunID)
+		runID := strconv.Itoa(int(nextRunID))
 		runSlice = append(runSlice, grid.Run{
 			ID:      nextRunID,
 			TestRun: run,
 		})
 		nextRunID++
 
-		resp, err := http.Get(run.RawResultsURL)
+		resp, err := http.Get(clients.ResultsURL(run.RawResultsURL))
 		if err != nil {
 			log.Printf("WARN: Failed to load raw results from \"%s\" for %v", run.RawResultsURL, run)
 			continue
@@ -105,7 +118,7 @@ func main() {
 			status := metrics.CompleteTestStatus{
 				Status: metrics.TestStatusFromString(res.Status),
 			}
-			testID := strconv.Itoa(testMap[baseName])
+			testID := strconv.Itoa(int(testMap[baseName]))
 			if _, ok := runsToTests[runID]; !ok {
 				runsToTests[runID] = make(map[string]metrics.CompleteTestStatus)
 			}
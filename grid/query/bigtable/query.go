@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"cloud.google.com/go/bigtable"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/profile"
 	"google.golang.org/api/option"
 )
 
@@ -27,10 +29,15 @@ func init() {
 func main() {
 	log.SetFlags(log.LstdFlags | log.Llongfile | log.LUTC)
 	flag.Parse()
+	profile.Apply(map[string]string{
+		"project_id":            "project",
+		"gcp_credentials_file":  "credentials_file",
+		"output_bt_instance_id": "bigtable_instance",
+	})
 
 	ctx := context.Background()
 
-	btClient, err := bigtable.NewClient(ctx, *projectID, *outputBTInstanceID, option.WithCredentialsFile(*gcpCredentialsFile))
+	btClient, err := clients.NewBigtable(ctx, *projectID, *outputBTInstanceID, option.WithCredentialsFile(*gcpCredentialsFile))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/web-platform-tests/data-migration/grid"
+	"github.com/web-platform-tests/data-migration/productspec"
 	"github.com/web-platform-tests/results-analysis/metrics"
 )
 
@@ -380,6 +381,12 @@ func runsFilterAnyStringSliceProperty(name, substr string) func(grid.Run, *[]gri
 	}
 }
 
+func runsFilterProductSpecs(specs productspec.ProductSpecs) func(grid.Run, *[]grid.Run) bool {
+	return func(r grid.Run, s *[]grid.Run) bool {
+		return specs.Matches(&r.TestRun)
+	}
+}
+
 func runsFilterLimit(limit int) func(grid.Run, *[]grid.Run) bool {
 	return func(r grid.Run, s *[]grid.Run) bool {
 		return s != nil && len(*s) < limit
@@ -419,6 +426,14 @@ func runsHandler(w http.ResponseWriter, r *http.Request) {
 			filter = runsFilterAnd(runsFilterAnyStringSliceProperty(propName, v), filter)
 		}
 	}
+	if v := q.Get("runs"); v != "" {
+		specs, err := productspec.ParseList(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter = runsFilterAnd(runsFilterProductSpecs(specs), filter)
+	}
 	limit := q.Get("limit")
 	if limit != "" {
 		lim, err := strconv.Atoi(limit)
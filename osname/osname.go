@@ -0,0 +1,75 @@
+package osname
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var tablePath *string
+
+func init() {
+	_, srcFilePath, _, ok := runtime.Caller(0)
+	if !ok {
+		log.Fatal(errors.New("Failed to get golang source file path"))
+	}
+	defaultTable := filepath.Clean(path.Dir(srcFilePath) + "/os_names.json")
+	tablePath = flag.String("os-table", defaultTable, "Path to the JSON OS name and version normalization table")
+}
+
+// Table maps (lower-case) variants of OS names to canonical names, and, for
+// each canonical name, (lower-case) variants of OS versions to canonical
+// versions. Purely numeric versions (e.g. "10.13") are canonical as is.
+type Table struct {
+	Names    map[string]string            `json:"names"`
+	Versions map[string]map[string]string `json:"versions"`
+}
+
+// Release is an OS name and version.
+type Release struct {
+	Name    string `json:"os_name"`
+	Version string `json:"os_version"`
+}
+
+// LoadTable reads the table at --os-table.
+func LoadTable() (Table, error) {
+	var table Table
+	bytes, err := ioutil.ReadFile(*tablePath)
+	if err != nil {
+		return table, err
+	}
+	err = json.Unmarshal(bytes, &table)
+	return table, err
+}
+
+var numericVersion = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// Normalize returns the canonical release. An unknown name is returned as it
+// is (nameKnown is false), with its version as is; an unknown version of a
+// known name is returned as it is (versionKnown is false).
+func (t Table) Normalize(r Release) (normalized Release, nameKnown, versionKnown bool) {
+	normalized = r
+	name := strings.ToLower(strings.TrimSpace(r.Name))
+	version := strings.ToLower(strings.TrimSpace(r.Version))
+
+	canonical, ok := t.Names[name]
+	if !ok {
+		return normalized, false, false
+	}
+	normalized.Name = canonical
+	if v, ok := t.Versions[canonical][version]; ok {
+		normalized.Version = v
+	} else if version == "" || numericVersion.MatchString(version) {
+		normalized.Version = version
+	} else {
+		return normalized, true, false
+	}
+	return normalized, true, true
+}
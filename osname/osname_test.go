@@ -0,0 +1,33 @@
+package osname
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	table, err := LoadTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, version           string
+		expected                Release
+		nameKnown, versionKnown bool
+	}{
+		{"windows", "10", Release{"windows", "10"}, true, true},
+		{"win", "Windows 10", Release{"windows", "10"}, true, true},
+		{" Win32 ", "win7", Release{"windows", "7"}, true, true},
+		{"Mac OS X", "High Sierra", Release{"mac", "10.13"}, true, true},
+		{"mac", "10.13.6", Release{"mac", "10.13.6"}, true, true},
+		{"linux", "*", Release{"linux", ""}, true, true},
+		{"ubuntu", "", Release{"linux", ""}, true, true},
+		{"linux", "Bionic Beaver", Release{"linux", "Bionic Beaver"}, true, false},
+		{"BeOS", "5", Release{"BeOS", "5"}, false, false},
+	}
+	for _, test := range tests {
+		normalized, nameKnown, versionKnown := table.Normalize(Release{test.name, test.version})
+		if normalized != test.expected || nameKnown != test.nameKnown || versionKnown != test.versionKnown {
+			t.Errorf("Normalize(%q, %q) = %+v, %v, %v; expected %+v, %v, %v",
+				test.name, test.version, normalized, nameKnown, versionKnown,
+				test.expected, test.nameKnown, test.versionKnown)
+		}
+	}
+}
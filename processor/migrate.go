@@ -4,9 +4,14 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"log"
 	"sync"
 
 	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/productspec"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/data-migration/provenance"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 	"google.golang.org/api/iterator"
 )
@@ -14,8 +19,19 @@ import (
 var (
 	dryRun    = flag.Bool("dry-run", false, "Only print out runs that would be affected")
 	projectID = flag.String("project", "wptdashboard-staging", "Google Cloud project")
+	runFilter productspec.ProductSpecs
 )
 
+func init() {
+	flag.Var(&runFilter, "runs", productspec.Usage)
+}
+
+// DryRun reports whether --dry-run is set, for processors that have side
+// effects outside of ProcessRun (e.g. in Prefetch).
+func DryRun() bool {
+	return *dryRun
+}
+
 // ConditionUnsatisfied is a non-fatal error when a run does not need to be processed.
 type ConditionUnsatisfied struct{}
 
@@ -23,8 +39,29 @@ func (e ConditionUnsatisfied) Error() string {
 	return "Condition not satisfied"
 }
 
-func ProcessRun(ctx context.Context, runsProcessor Runs, dsClient *datastore.Client, key *datastore.Key, wg *sync.WaitGroup) {
-	defer wg.Done()
+// ProcessRun checks and (unless dry-running) processes a single TestRun in a
+// transaction. It returns whether the run satisfied the processor's condition.
+// Label and field changes are recorded in the run's provenance, in the same
+// transaction (which cannot read its own writes, so they are recorded here
+// rather than by the processors). Processors implementing Preparer are
+// prepared for the run before the transaction.
+func ProcessRun(ctx context.Context, runsProcessor Runs, dsClient *datastore.Client, key *datastore.Key) bool {
+	preparer, prepare := runsProcessor.(Preparer)
+	prepare = prepare && !*dryRun
+	if prepare {
+		var current shared.TestRun
+		if err := dsClient.Get(ctx, key, &current); err != nil {
+			panic(err)
+		}
+		current.ID = key.ID
+		if !runFilter.Matches(&current) || !runsProcessor.ShouldProcessRun(&current) {
+			return false
+		}
+		if err := preparer.Prepare(&current); err != nil {
+			log.Printf("Failed to prepare TestRun %s, skipping: %v", key.String(), err)
+			return false
+		}
+	}
 
 	var run shared.TestRun
 	_, err := dsClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
@@ -32,11 +69,17 @@ func ProcessRun(ctx context.Context, runsProcessor Runs, dsClient *datastore.Cli
 		if err != nil {
 			return err
 		}
-		if runsProcessor.ShouldProcessRun(&run) {
+		run.ID = key.ID
+		if runFilter.Matches(&run) && runsProcessor.ShouldProcessRun(&run) {
 			if *dryRun {
 				return nil
 			}
-			return runsProcessor.ProcessRun(tx, key, &run)
+			before := run
+			before.Labels = append([]string(nil), run.Labels...)
+			if err := runsProcessor.ProcessRun(tx, key, &run); err != nil {
+				return err
+			}
+			return provenance.Update(tx, key, processorNames([]Runs{runsProcessor}), &before, &run)
 		}
 		return ConditionUnsatisfied{}
 	})
@@ -45,10 +88,87 @@ func ProcessRun(ctx context.Context, runsProcessor Runs, dsClient *datastore.Cli
 		if !ok {
 			panic(err)
 		} else {
-			return
+			return false
 		}
 	}
+	if prepare {
+		preparer.Committed(&run)
+	}
 	fmt.Printf("Processed TestRun %s (%s %s)\n", key.String(), run.BrowserName, run.BrowserVersion)
+	return true
+}
+
+// LoadRuns loads all TestRuns, with their IDs set. It is meant for processors
+// that compare runs with each other, which need to see all runs before calling
+// MigrateData.
+func LoadRuns() []shared.TestRun {
+	flag.Parse()
+	profile.Apply(map[string]string{"project": "project"})
+
+	ctx := context.Background()
+	dsClient, err := clients.NewDatastore(ctx, *projectID)
+	if err != nil {
+		panic(err)
+	}
+	var runs []shared.TestRun
+	keys, err := dsClient.GetAll(ctx, datastore.NewQuery("TestRun"), &runs)
+	if err != nil {
+		panic(err)
+	}
+	for i := range runs {
+		runs[i].ID = keys[i].ID
+	}
+	fmt.Printf("Loaded %d TestRuns\n", len(runs))
+	return runs
+}
+
+// prefetch calls the Prefetch method of the processors that implement
+// Prefetcher with the given runs.
+func prefetch(runsProcessors []Runs, runs []shared.TestRun) {
+	for _, runsProcessor := range runsProcessors {
+		if prefetcher, ok := runsProcessor.(Prefetcher); ok {
+			prefetcher.Prefetch(runs)
+		}
+	}
+}
+
+func needsPrefetch(runsProcessors []Runs) bool {
+	for _, runsProcessor := range runsProcessors {
+		if _, ok := runsProcessor.(Prefetcher); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedRuns loads the runs a full pass will consider, i.e. those matching
+// --runs and --sample-percent that are not skipped, with their IDs set.
+func selectedRuns(ctx context.Context, dsClient *datastore.Client, skip map[string]bool) []shared.TestRun {
+	var runs []shared.TestRun
+	keys, err := dsClient.GetAll(ctx, datastore.NewQuery("TestRun"), &runs)
+	if err != nil {
+		panic(err)
+	}
+	selected := make([]shared.TestRun, 0, len(runs))
+	for i, run := range runs {
+		run.ID = keys[i].ID
+		if !skip[keys[i].Encode()] && inSample(keys[i]) && runFilter.Matches(&run) {
+			selected = append(selected, run)
+		}
+	}
+	return selected
+}
+
+// processAll applies each of the processors to the run, in order, and returns
+// whether any of them processed it.
+func processAll(ctx context.Context, runsProcessors []Runs, dsClient *datastore.Client, key *datastore.Key) bool {
+	processed := false
+	for _, runsProcessor := range runsProcessors {
+		if ProcessRun(ctx, runsProcessor, dsClient, key) {
+			processed = true
+		}
+	}
+	return processed
 }
 
 // MigrateData handles all the loading and transactions across the full
@@ -58,19 +178,35 @@ func ProcessRun(ctx context.Context, runsProcessor Runs, dsClient *datastore.Cli
 //   p := experimentalLabeller{}
 //   processor.MigrateData(p)
 // }
-func MigrateData(runsProcessor Runs) {
+//
+// Several processors may be given; they are applied to each run in order. With
+// --watch, it keeps applying them to newly created runs instead.
+func MigrateData(runsProcessors ...Runs) {
 	flag.Parse()
+	profile.Apply(map[string]string{"project": "project"})
 	if *dryRun {
 		fmt.Println("Dry running; data will NOT be modified...")
+	} else {
+		profile.GuardWrite(*projectID)
 	}
 
 	ctx := context.Background()
 
-	dsClient, err := datastore.NewClient(ctx, *projectID)
+	dsClient, err := clients.NewDatastore(ctx, *projectID)
 	if err != nil {
 		panic(err)
 	}
 
+	if *watch {
+		watchRuns(ctx, runsProcessors, dsClient)
+		return
+	}
+
+	skip := loadProcessedKeys()
+	if needsPrefetch(runsProcessors) {
+		prefetch(runsProcessors, selectedRuns(ctx, dsClient, skip))
+	}
+	summary := newSummary(runsProcessors)
 	query := datastore.NewQuery("TestRun").Order("-TimeStart").KeysOnly()
 
 	var wg sync.WaitGroup
@@ -82,9 +218,27 @@ func MigrateData(runsProcessor Runs) {
 		if err != nil {
 			panic(err)
 		}
+		if skip[key.Encode()] || !inSample(key) {
+			continue
+		}
+		summary.scanned()
+
+		// "The first N runs" is only well-defined when processing in order.
+		if *sampleSize > 0 {
+			if processAll(ctx, runsProcessors, dsClient, key) && summary.processed(key) >= *sampleSize {
+				break
+			}
+			continue
+		}
 
 		wg.Add(1)
-		go ProcessRun(ctx, runsProcessor, dsClient, key, &wg)
+		go func(key *datastore.Key) {
+			defer wg.Done()
+			if processAll(ctx, runsProcessors, dsClient, key) {
+				summary.processed(key)
+			}
+		}(key)
 	}
 	wg.Wait()
+	summary.finish()
 }
@@ -10,3 +10,31 @@ type Runs interface {
 	ShouldProcessRun(run *shared.TestRun) bool
 	ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error
 }
+
+// Reporter can be implemented by processors that collect findings (e.g. runs
+// they could not handle) to be included in the migration summary.
+type Reporter interface {
+	Report() interface{}
+}
+
+// Prefetcher can be implemented by processors that need data that is too slow
+// to fetch in a transaction, e.g. raw reports (see report.FetchAll). Prefetch
+// is called outside of transactions with the runs about to be processed
+// (those matching --runs and --sample-percent; in --watch mode, each batch of
+// new runs), before any of them is processed.
+type Prefetcher interface {
+	Prefetch(runs []shared.TestRun)
+}
+
+// Preparer can be implemented by processors with side effects outside of
+// Datastore (e.g. writing a file a run is about to refer to), which must not
+// happen in transactions, as they may be retried. Prepare is called right
+// before the transaction processing a run, with the run as read outside of it,
+// if ShouldProcessRun accepts it (and never when dry-running); the run is
+// skipped if it fails. Committed is called once the transaction has committed,
+// so that the effects of Prepare for runs that were not processed after all
+// (e.g. because the run changed in between) can be reported for cleanup.
+type Preparer interface {
+	Prepare(run *shared.TestRun) error
+	Committed(run *shared.TestRun)
+}
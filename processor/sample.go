@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+
+	"cloud.google.com/go/datastore"
+)
+
+var (
+	samplePercent   = flag.Float64("sample-percent", 0, "Only consider a deterministic random sample of this percentage of runs")
+	sampleSize      = flag.Int("sample-size", 0, "Stop after processing the first N runs (in scan order) that need processing")
+	sampleSeed      = flag.Int64("sample-seed", 0, "Seed that determines which runs --sample-percent selects")
+	skipProcessedIn = flag.String("skip-processed-in", "", "Skip runs already processed by an earlier migration, as recorded in its --summary file")
+)
+
+// Sample describes the subset of runs a canary migration was limited to.
+type Sample struct {
+	Percent float64 `json:"percent,omitempty"`
+	Size    int     `json:"size,omitempty"`
+	Seed    int64   `json:"seed"`
+}
+
+func sampleFromFlags() *Sample {
+	if *samplePercent <= 0 && *sampleSize <= 0 {
+		return nil
+	}
+	return &Sample{
+		Percent: *samplePercent,
+		Size:    *sampleSize,
+		Seed:    *sampleSeed,
+	}
+}
+
+// inSample reports whether the run with the given key belongs to the random
+// sample selected by --sample-percent. The selection only depends on the seed
+// and the key, so the same sample is picked on every invocation.
+func inSample(key *datastore.Key) bool {
+	if *samplePercent <= 0 || *samplePercent >= 100 {
+		return true
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s", *sampleSeed, key.String())
+	return float64(h.Sum64()%10000) < *samplePercent*100
+}
+
+// loadProcessedKeys reads the set of (encoded) keys processed by the migration
+// whose summary is given by --skip-processed-in.
+func loadProcessedKeys() map[string]bool {
+	skip := make(map[string]bool)
+	if *skipProcessedIn == "" {
+		return skip
+	}
+	bytes, err := ioutil.ReadFile(*skipProcessedIn)
+	if err != nil {
+		panic(err)
+	}
+	var previous Summary
+	if err := json.Unmarshal(bytes, &previous); err != nil {
+		panic(err)
+	}
+	if previous.DryRun {
+		panic(fmt.Sprintf("%s is the summary of a dry run; its runs were never modified", *skipProcessedIn))
+	}
+	for _, key := range previous.Processed {
+		skip[key] = true
+	}
+	fmt.Printf("Skipping %d runs already processed according to %s\n", len(skip), *skipProcessedIn)
+	return skip
+}
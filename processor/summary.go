@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+var summaryPath = flag.String("summary", "", "Write a JSON summary of the migration to this file")
+
+// Summary records what a migration did. It is printed when the migration
+// finishes and, with --summary, saved so that a sampled migration can later be
+// continued with --skip-processed-in.
+type Summary struct {
+	Project         string    `json:"project"`
+	Processor       string    `json:"processor"`
+	DryRun          bool      `json:"dry_run"`
+	Sample          *Sample   `json:"sample,omitempty"`
+	SkipProcessedIn string    `json:"skip_processed_in,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	Scanned         int       `json:"scanned"`
+	// Processed contains the encoded keys of all processed runs.
+	Processed []string `json:"processed"`
+	// Reports contains the reports of processors implementing Reporter.
+	Reports map[string]interface{} `json:"reports,omitempty"`
+
+	runsProcessors []Runs
+	mutex          sync.Mutex
+}
+
+func processorNames(runsProcessors []Runs) string {
+	names := make([]string, 0, len(runsProcessors))
+	for _, runsProcessor := range runsProcessors {
+		names = append(names, fmt.Sprintf("%T", runsProcessor))
+	}
+	return strings.Join(names, ",")
+}
+
+func newSummary(runsProcessors []Runs) *Summary {
+	return &Summary{
+		Project:         *projectID,
+		Processor:       processorNames(runsProcessors),
+		DryRun:          *dryRun,
+		Sample:          sampleFromFlags(),
+		SkipProcessedIn: *skipProcessedIn,
+		Started:         time.Now(),
+		Processed:       make([]string, 0),
+		runsProcessors:  runsProcessors,
+	}
+}
+
+func (s *Summary) scanned() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Scanned++
+}
+
+// processed records a processed run and returns the number of runs processed
+// so far.
+func (s *Summary) processed(key *datastore.Key) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Processed = append(s.Processed, key.Encode())
+	return len(s.Processed)
+}
+
+func (s *Summary) finish() {
+	s.Finished = time.Now()
+	fmt.Printf("Processed %d of %d scanned TestRuns in %v\n", len(s.Processed), s.Scanned, s.Finished.Sub(s.Started))
+	for _, runsProcessor := range s.runsProcessors {
+		reporter, ok := runsProcessor.(Reporter)
+		if !ok {
+			continue
+		}
+		if s.Reports == nil {
+			s.Reports = make(map[string]interface{})
+		}
+		name := fmt.Sprintf("%T", runsProcessor)
+		s.Reports[name] = reporter.Report()
+		bytes, err := json.MarshalIndent(s.Reports[name], "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Report of %s:\n%s\n", name, string(bytes))
+	}
+	if *summaryPath == "" {
+		return
+	}
+	bytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(*summaryPath, bytes, 0644); err != nil {
+		panic(err)
+	}
+	fmt.Printf("Summary written to %s\n", *summaryPath)
+}
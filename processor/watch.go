@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/data-migration/provenance"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	watch         = flag.Bool("watch", false, "Keep running and apply the processor(s) to newly created TestRuns")
+	watchInterval = flag.Duration("watch-interval", time.Minute, "How often to poll for new TestRuns in --watch mode")
+	watchState    = flag.String("watch-state", "", "File persisting the latest CreatedAt seen in --watch mode (default: derived from the processor names)")
+)
+
+// highWaterMark is the state persisted between polls (and restarts) of
+// --watch mode.
+type highWaterMark struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Seen lists the (encoded) keys of the runs created at exactly CreatedAt
+	// that were already handled, as several runs may share a CreatedAt.
+	Seen []string `json:"seen,omitempty"`
+}
+
+func (h highWaterMark) seen(key *datastore.Key) bool {
+	encoded := key.Encode()
+	for _, k := range h.Seen {
+		if k == encoded {
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves the mark to the given run, which must not be older than the
+// mark.
+func (h *highWaterMark) advance(key *datastore.Key, createdAt time.Time) {
+	if !createdAt.Equal(h.CreatedAt) {
+		h.CreatedAt = createdAt
+		h.Seen = nil
+	}
+	h.Seen = append(h.Seen, key.Encode())
+}
+
+func watchStatePath(runsProcessors []Runs) string {
+	if *watchState != "" {
+		return *watchState
+	}
+	name := regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(processorNames(runsProcessors), "_")
+	return fmt.Sprintf("watch-%s.json", name)
+}
+
+// loadHighWaterMark reads the persisted state, falling back to the CreatedAt
+// of the newest existing run(s), i.e. only runs created from now on are
+// processed. Use a full (non-watch) pass to cover older runs.
+func loadHighWaterMark(ctx context.Context, dsClient *datastore.Client, path string) highWaterMark {
+	var hwm highWaterMark
+	bytes, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(bytes, &hwm); err != nil {
+			log.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		return hwm
+	}
+	if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	var latest []shared.TestRun
+	if _, err := dsClient.GetAll(ctx, datastore.NewQuery("TestRun").Order("-CreatedAt").Limit(1), &latest); err != nil {
+		log.Fatal(err)
+	}
+	if len(latest) > 0 {
+		hwm.CreatedAt = latest[0].CreatedAt
+		query := datastore.NewQuery("TestRun").Filter("CreatedAt =", hwm.CreatedAt).KeysOnly()
+		keys, err := dsClient.GetAll(ctx, query, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, key := range keys {
+			hwm.Seen = append(hwm.Seen, key.Encode())
+		}
+	}
+	return hwm
+}
+
+func saveHighWaterMark(path string, hwm highWaterMark) {
+	bytes, err := json.Marshal(hwm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, bytes, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// trackUploaded records the labels of a new run as set by the uploader, before
+// any processor touches them.
+func trackUploaded(ctx context.Context, dsClient *datastore.Client, key *datastore.Key) {
+	_, err := dsClient.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var run shared.TestRun
+		if err := tx.Get(key, &run); err != nil {
+			return err
+		}
+		return provenance.TrackUploaded(tx, key, &run)
+	})
+	if err != nil {
+		log.Printf("Failed to record the label provenance of TestRun %s: %v", key.String(), err)
+	}
+}
+
+// watchRuns polls forever for TestRuns created since the high-water mark (and
+// not seen yet) and applies the processors to them, oldest first, after
+// prefetching for the whole batch of new runs of each poll. The mark is
+// not persisted when dry-running, so that a dry run does not make a later run
+// skip anything.
+func watchRuns(ctx context.Context, runsProcessors []Runs, dsClient *datastore.Client) {
+	path := watchStatePath(runsProcessors)
+	hwm := loadHighWaterMark(ctx, dsClient, path)
+	log.Printf("Watching for TestRuns created since %v (state in %s)", hwm.CreatedAt, path)
+
+	for {
+		query := datastore.NewQuery("TestRun").Filter("CreatedAt >=", hwm.CreatedAt).Order("CreatedAt")
+		var keys []*datastore.Key
+		var runs []shared.TestRun
+		for t := dsClient.Run(ctx, query); ; {
+			var run shared.TestRun
+			key, err := t.Next(&run)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Printf("Failed to poll for new TestRuns: %v", err)
+				break
+			}
+			if hwm.seen(key) {
+				continue
+			}
+			run.ID = key.ID
+			keys = append(keys, key)
+			runs = append(runs, run)
+		}
+
+		if len(runs) > 0 && needsPrefetch(runsProcessors) {
+			selected := make([]shared.TestRun, 0, len(runs))
+			for i := range runs {
+				if runFilter.Matches(&runs[i]) {
+					selected = append(selected, runs[i])
+				}
+			}
+			prefetch(runsProcessors, selected)
+		}
+		for i, key := range keys {
+			if !*dryRun {
+				trackUploaded(ctx, dsClient, key)
+			}
+			processAll(ctx, runsProcessors, dsClient, key)
+			hwm.advance(key, runs[i].CreatedAt)
+			if !*dryRun {
+				saveHighWaterMark(path, hwm)
+			}
+		}
+		time.Sleep(*watchInterval)
+	}
+}
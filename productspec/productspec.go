@@ -0,0 +1,216 @@
+package productspec
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// Usage describes the product spec syntax, for flag help texts.
+const Usage = "Only process runs matching one of these comma-separated wpt.fyi product specs, e.g. chrome[experimental,master]-70@abc123,firefox-experimental,safari-12[stable]"
+
+// experimental is the label selected by a "-experimental" browser name suffix.
+const experimental = "experimental"
+
+// ProductSpec selects runs like wpt.fyi product specs, i.e.
+// browser[label,...]-version-os-os_version@revision, where everything but the
+// browser name is optional, and the labels may also follow the OS version (as
+// in wpt.fyi). As in shared.ParseProductSpec, a "-experimental" browser name
+// suffix selects the experimental label (e.g. "chrome-experimental" is
+// chrome[experimental]), and the revision may be "latest" (any revision).
+type ProductSpec struct {
+	// BrowserName never has the "-experimental" suffix; Matches trims it from
+	// the legacy browser names of runs, which count as labelled experimental.
+	BrowserName string
+	// Labels must all be present on a matching run.
+	Labels []string
+	// BrowserVersion, OSName and OSVersion match by prefix, on "." and " "
+	// boundaries (so "70" matches "70.0.3538.9 dev" but not "7" or "700").
+	BrowserVersion string
+	OSName         string
+	OSVersion      string
+	// Revision is a (possibly abbreviated) revision hash.
+	Revision string
+}
+
+var specPattern = regexp.MustCompile(`^([A-Za-z_]+)(?:\[([^\]]*)\])?((?:-[^-@\[\]]+)*)(?:\[([^\]]*)\])?(?:@([0-9a-fA-F]+|latest))?$`)
+
+// Parse parses a single product spec.
+func Parse(s string) (ProductSpec, error) {
+	match := specPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return ProductSpec{}, fmt.Errorf("Invalid product spec %q", s)
+	}
+	spec := ProductSpec{BrowserName: strings.ToLower(match[1])}
+	if !shared.IsBrowserName(spec.BrowserName) {
+		return ProductSpec{}, fmt.Errorf("Invalid product spec %q: unknown browser %s", s, spec.BrowserName)
+	}
+	parts := strings.Split(match[3], "-")[1:]
+	if len(parts) > 0 && strings.ToLower(parts[0]) == experimental {
+		spec.Labels = append(spec.Labels, experimental)
+		parts = parts[1:]
+	}
+	if len(parts) > 3 {
+		return ProductSpec{}, fmt.Errorf("Invalid product spec %q: too many version parts", s)
+	}
+	for i, part := range []*string{&spec.BrowserVersion, &spec.OSName, &spec.OSVersion}[:len(parts)] {
+		*part = parts[i]
+	}
+	if match[2] != "" && match[4] != "" {
+		return ProductSpec{}, fmt.Errorf("Invalid product spec %q: more than one list of labels", s)
+	}
+	for _, label := range strings.Split(match[2]+match[4], ",") {
+		if label = strings.TrimSpace(label); label != "" && !contains(spec.Labels, label) {
+			spec.Labels = append(spec.Labels, label)
+		}
+	}
+	if revision := strings.ToLower(match[5]); revision != "latest" {
+		spec.Revision = revision
+	}
+	return spec, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the spec in product spec syntax.
+func (p ProductSpec) String() string {
+	s := p.BrowserName
+	if len(p.Labels) > 0 {
+		s += "[" + strings.Join(p.Labels, ",") + "]"
+	}
+	for _, part := range []string{p.BrowserVersion, p.OSName, p.OSVersion} {
+		if part == "" {
+			break
+		}
+		s += "-" + part
+	}
+	if p.Revision != "" {
+		s += "@" + p.Revision
+	}
+	return s
+}
+
+func matchesPrefix(value, prefix string) bool {
+	if prefix == "" || value == prefix {
+		return true
+	}
+	return strings.HasPrefix(value, prefix) && strings.ContainsAny(value[len(prefix):len(prefix)+1], ". ")
+}
+
+// Matches reports whether the run matches the spec.
+func (p ProductSpec) Matches(run *shared.TestRun) bool {
+	browserName := strings.TrimSuffix(run.BrowserName, "-"+experimental)
+	if browserName != p.BrowserName {
+		return false
+	}
+	if !matchesPrefix(run.BrowserVersion, p.BrowserVersion) ||
+		!matchesPrefix(run.OSName, p.OSName) ||
+		!matchesPrefix(run.OSVersion, p.OSVersion) {
+		return false
+	}
+	if p.Revision != "" {
+		revision := run.FullRevisionHash
+		if revision == "" {
+			revision = run.Revision
+		}
+		// Either may be abbreviated.
+		if revision == "" || !strings.HasPrefix(revision, p.Revision) && !strings.HasPrefix(p.Revision, revision) {
+			return false
+		}
+	}
+	labels := run.LabelsSet()
+	if browserName != run.BrowserName {
+		labels.Add(experimental)
+	}
+	for _, label := range p.Labels {
+		if !labels.Contains(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// ProductSpecs is a list of product specs. It implements flag.Value, e.g.
+//
+// var runs productspec.ProductSpecs
+// flag.Var(&runs, "runs", productspec.Usage)
+type ProductSpecs []ProductSpec
+
+// ParseList parses comma-separated product specs (commas within the label
+// brackets do not separate specs).
+func ParseList(s string) (ProductSpecs, error) {
+	parts := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+
+	specs := make(ProductSpecs, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		spec, err := Parse(part)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Matches reports whether the run matches any of the specs. An empty list
+// matches all runs.
+func (s ProductSpecs) Matches(run *shared.TestRun) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, spec := range s {
+		if spec.Matches(run) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the specs in product spec syntax, comma-separated.
+func (s *ProductSpecs) String() string {
+	if s == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(*s))
+	for _, spec := range *s {
+		parts = append(parts, spec.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses the flag value.
+func (s *ProductSpecs) Set(value string) error {
+	specs, err := ParseList(value)
+	if err != nil {
+		return err
+	}
+	*s = specs
+	return nil
+}
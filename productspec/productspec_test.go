@@ -0,0 +1,96 @@
+package productspec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected ProductSpec
+	}{
+		{"chrome", ProductSpec{BrowserName: "chrome"}},
+		{"Chrome-70", ProductSpec{BrowserName: "chrome", BrowserVersion: "70"}},
+		{"chrome[experimental,master]-70@ABC123", ProductSpec{BrowserName: "chrome", Labels: []string{"experimental", "master"}, BrowserVersion: "70", Revision: "abc123"}},
+		{"safari-12-mac-10.13[stable]", ProductSpec{BrowserName: "safari", Labels: []string{"stable"}, BrowserVersion: "12", OSName: "mac", OSVersion: "10.13"}},
+		{"chrome-experimental", ProductSpec{BrowserName: "chrome", Labels: []string{"experimental"}}},
+		{"chrome-experimental-72[master]", ProductSpec{BrowserName: "chrome", Labels: []string{"experimental", "master"}, BrowserVersion: "72"}},
+		{"chrome[experimental]-experimental", ProductSpec{BrowserName: "chrome", Labels: []string{"experimental"}}},
+		{"firefox@latest", ProductSpec{BrowserName: "firefox"}},
+	}
+	for _, test := range tests {
+		spec, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", test.spec, err.Error())
+		} else if !reflect.DeepEqual(spec, test.expected) {
+			t.Errorf("Parse(%q) = %+v; expected %+v", test.spec, spec, test.expected)
+		}
+	}
+
+	for _, invalid := range []string{"", "netscape", "chrome-70-linux-4.4-extra", "chrome[a]-70[b]", "chrome@xyz"} {
+		if spec, err := Parse(invalid); err == nil {
+			t.Errorf("Parse(%q) = %+v; expected an error", invalid, spec)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	run := func(browserName, browserVersion, revision string, labels ...string) *shared.TestRun {
+		r := &shared.TestRun{Labels: labels}
+		r.BrowserName = browserName
+		r.BrowserVersion = browserVersion
+		r.Revision = revision
+		return r
+	}
+	stable := run("chrome", "70.0.3538.77", "abc1234567", "chrome", "stable")
+	experimental := run("chrome", "72.0.3626.7 dev", "abc1234567", "chrome", "experimental")
+	legacy := run("chrome-experimental", "72.0.3626.7 dev", "def1234567")
+
+	tests := []struct {
+		spec     string
+		run      *shared.TestRun
+		expected bool
+	}{
+		{"chrome", stable, true},
+		{"chrome", legacy, true},
+		{"firefox", stable, false},
+		{"chrome-70", stable, true},
+		{"chrome-7", stable, false},
+		{"chrome-70.0", stable, true},
+		{"chrome[stable]", stable, true},
+		{"chrome[stable]", experimental, false},
+		{"chrome-experimental", stable, false},
+		{"chrome-experimental", experimental, true},
+		{"chrome-experimental", legacy, true},
+		{"chrome[experimental]-72", legacy, true},
+		{"chrome@abc123", stable, true},
+		{"chrome@abc1234567ff", stable, true},
+		{"chrome@def", stable, false},
+		{"chrome@latest", legacy, true},
+	}
+	for _, test := range tests {
+		spec, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", test.spec, err.Error())
+		}
+		if matches := spec.Matches(test.run); matches != test.expected {
+			t.Errorf("%q matches %s %s %v: %v; expected %v", test.spec, test.run.BrowserName, test.run.BrowserVersion, test.run.Labels, matches, test.expected)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	specs, err := ParseList("chrome[experimental,master]-70, firefox-experimental")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := specs.String(); s != "chrome[experimental,master]-70,firefox[experimental]" {
+		t.Errorf("ParseList: got %s", s)
+	}
+	if !(ProductSpecs{}).Matches(&shared.TestRun{}) {
+		t.Error("An empty list should match all runs")
+	}
+}
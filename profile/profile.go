@@ -0,0 +1,200 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+var profileName *string
+var profilesFile *string
+var confirmProduction *bool
+
+func init() {
+	profileName = flag.String("profile", "", "Named environment profile (e.g. staging, prod) providing defaults for project, buckets, etc.")
+	profilesFile = flag.String("profiles-file", "", "Path to the JSON file defining environment profiles (default: profiles.json in the source tree, the working directory or next to the binary)")
+	confirmProduction = flag.Bool("confirm-production", false, "Confirm that this command may modify a production project")
+}
+
+// Profile bundles the Google Cloud resources of one wpt.fyi environment.
+type Profile struct {
+	Project          string `json:"project"`
+	ResultsBucket    string `json:"results_bucket"`
+	ShardedBucket    string `json:"sharded_bucket"`
+	BigtableInstance string `json:"bigtable_instance"`
+	CredentialsFile  string `json:"credentials_file"`
+	// SnapshotBucket is where Datastore is exported to before a write-mode
+	// command runs against a production profile.
+	SnapshotBucket string `json:"snapshot_bucket"`
+	Production     bool   `json:"production"`
+
+	// Emulator endpoints (host:port), for profiles pointing at local stand-ins.
+	DatastoreEmulatorHost string `json:"datastore_emulator_host"`
+	StorageEmulatorHost   string `json:"storage_emulator_host"`
+	BigtableEmulatorHost  string `json:"bigtable_emulator_host"`
+}
+
+// emulatorFields are applied for every command; see the clients package.
+var emulatorFields = map[string]string{
+	"datastore-emulator-host": "datastore_emulator_host",
+	"storage-emulator-host":   "storage_emulator_host",
+	"bigtable-emulator-host":  "bigtable_emulator_host",
+}
+
+func (p *Profile) field(name string) string {
+	switch name {
+	case "project":
+		return p.Project
+	case "results_bucket":
+		return p.ResultsBucket
+	case "sharded_bucket":
+		return p.ShardedBucket
+	case "bigtable_instance":
+		return p.BigtableInstance
+	case "credentials_file":
+		return p.CredentialsFile
+	case "datastore_emulator_host":
+		return p.DatastoreEmulatorHost
+	case "storage_emulator_host":
+		return p.StorageEmulatorHost
+	case "bigtable_emulator_host":
+		return p.BigtableEmulatorHost
+	}
+	log.Fatalf("Unknown profile field: %s", name)
+	return ""
+}
+
+// findProfilesFile returns --profiles-file, or else the first profiles.json
+// found in the source tree (for go run), the working directory or next to the
+// binary; "" if there is none.
+func findProfilesFile() string {
+	if *profilesFile != "" {
+		return *profilesFile
+	}
+	candidates := []string{"profiles.json"}
+	if _, srcFilePath, _, ok := runtime.Caller(0); ok {
+		candidates = append([]string{filepath.Join(filepath.Dir(srcFilePath), "..", "profiles.json")}, candidates...)
+	}
+	if executable, err := os.Executable(); err == nil {
+		candidates = append(candidates, filepath.Join(filepath.Dir(executable), "profiles.json"))
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// loadProfiles reads the profiles file. A missing file is fatal if it is
+// required (i.e. with --profile or --profiles-file), and means no profiles
+// otherwise.
+func loadProfiles(required bool) map[string]*Profile {
+	profiles := make(map[string]*Profile)
+	file := findProfilesFile()
+	if file == "" {
+		if required || *profilesFile != "" {
+			log.Fatal(errors.New("Failed to find profiles.json; pass --profiles-file"))
+		}
+		return profiles
+	}
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Failed to read profiles from %s: %v", file, err)
+	}
+	if err := json.Unmarshal(bytes, &profiles); err != nil {
+		log.Fatalf("Failed to parse profiles from %s: %v", file, err)
+	}
+	return profiles
+}
+
+// Apply loads the profile selected with --profile (if any) and uses it for the
+// defaults of the command's flags. fields maps flag names to the JSON name of
+// the profile field they correspond to, e.g. {"project_id": "project"}. Flags
+// set explicitly on the command line take precedence over the profile. It must
+// be called after flag.Parse().
+func Apply(fields map[string]string) *Profile {
+	if *profileName == "" {
+		return nil
+	}
+	p, ok := loadProfiles(true)[*profileName]
+	if !ok {
+		log.Fatalf("No profile named %s in %s", *profileName, findProfilesFile())
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, field := range emulatorFields {
+		if flag.Lookup(name) != nil {
+			fields[name] = field
+		}
+	}
+	for name, field := range fields {
+		if explicit[name] || p.field(field) == "" {
+			continue
+		}
+		if err := flag.Set(name, p.field(field)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Commands without a credentials flag use application default credentials.
+	if p.CredentialsFile != "" && os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") == "" {
+		if _, err := os.Stat(p.CredentialsFile); err == nil {
+			os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", p.CredentialsFile)
+		}
+	}
+	log.Printf("Using profile %s (project %s)", *profileName, p.Project)
+	return p
+}
+
+// productionProfile returns the production profile for the given project, or
+// nil if the project does not belong to any production profile. Without
+// --profile, the profiles file is optional: if there is none, no project is
+// known to be production.
+func productionProfile(project string) *Profile {
+	profiles := loadProfiles(*profileName != "")
+	if len(profiles) == 0 {
+		log.Printf("No profiles file found; not checking whether %s is a production project", project)
+	}
+	for _, p := range profiles {
+		if p.Production && p.Project == project {
+			return p
+		}
+	}
+	return nil
+}
+
+// GuardWrite must be called before a command modifies Datastore in the given
+// project. For production projects it requires --confirm-production and takes
+// a snapshot (a managed Datastore export) before returning.
+func GuardWrite(project string) {
+	p := productionProfile(project)
+	if p == nil {
+		return
+	}
+	if !*confirmProduction {
+		log.Fatalf("%s is a production project; rerun with --confirm-production to modify it", project)
+	}
+	log.Printf("Production write to %s confirmed", project)
+	if p.SnapshotBucket == "" {
+		log.Fatalf("No snapshot_bucket configured for production project %s", project)
+	}
+	snapshot := fmt.Sprintf("gs://%s/%s-%s", p.SnapshotBucket, filepath.Base(os.Args[0]), time.Now().UTC().Format("20060102-150405"))
+	log.Printf("Taking pre-migration snapshot of %s in %s", project, snapshot)
+	cmd := exec.Command("gcloud", "datastore", "export", "--project", project, snapshot)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Fatalf("Failed to snapshot %s: %v", project, err)
+	}
+}
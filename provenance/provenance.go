@@ -0,0 +1,201 @@
+package provenance
+
+import (
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// Kind is the Datastore kind of label provenance records. A record has the
+// same ID as its TestRun. Records also keep the previous values of the
+// TestRun fields that migrations change (e.g. TimeStart), so that they can be
+// recovered.
+const Kind = "TestRunLabelProvenance"
+
+// Sources of labels that were not added by a migration.
+const (
+	// Uploader is the source of the labels a run was created with. It is only
+	// known for runs that were first seen by a migration in --watch mode.
+	Uploader = "uploader"
+	// Untracked is the source of the labels a run had when its provenance
+	// was first recorded, which may have been added by the uploader or by
+	// earlier migrations.
+	Untracked = "untracked"
+)
+
+// Actions of events.
+const (
+	Added   = "added"
+	Removed = "removed"
+	// Changed is the action of field events.
+	Changed = "changed"
+)
+
+// Event is the addition or removal of a label, or the change of a field
+// (with Field, From and To set instead of Label).
+type Event struct {
+	Label  string    `json:"label,omitempty"`
+	Field  string    `json:"field,omitempty"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	Action string    `json:"action"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+}
+
+// History is the provenance record of a TestRun: the label events, oldest
+// first.
+type History struct {
+	Events []Event `datastore:",noindex"`
+}
+
+// Key returns the key of the provenance record of the TestRun.
+func Key(runKey *datastore.Key) *datastore.Key {
+	return datastore.IDKey(Kind, runKey.ID, nil)
+}
+
+// Load loads the provenance record of the TestRun. found is false if there is
+// none yet.
+func Load(tx *datastore.Transaction, runKey *datastore.Key) (history History, found bool, err error) {
+	err = tx.Get(Key(runKey), &history)
+	if err == datastore.ErrNoSuchEntity {
+		return History{}, false, nil
+	}
+	return history, err == nil, err
+}
+
+// baseline records the labels of a run without a provenance record as coming
+// from the given source.
+func baseline(labels []string, source string, t time.Time) []Event {
+	events := make([]Event, 0, len(labels))
+	for _, label := range labels {
+		events = append(events, Event{Label: label, Action: Added, Source: source, Time: t})
+	}
+	return events
+}
+
+// TrackUploaded creates the provenance record of a new run, attributing its
+// labels to the uploader, unless it already has one.
+func TrackUploaded(tx *datastore.Transaction, runKey *datastore.Key, run *shared.TestRun) error {
+	_, found, err := Load(tx, runKey)
+	if err != nil || found {
+		return err
+	}
+	_, err = tx.Put(Key(runKey), &History{Events: baseline(run.Labels, Uploader, run.CreatedAt)})
+	return err
+}
+
+// fields returns the tracked fields of the run, by name, as strings.
+func fields(run *shared.TestRun) map[string]string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return map[string]string{
+		"browser_name":       run.BrowserName,
+		"browser_version":    run.BrowserVersion,
+		"os_name":            run.OSName,
+		"os_version":         run.OSVersion,
+		"revision":           run.Revision,
+		"full_revision_hash": run.FullRevisionHash,
+		"results_url":        run.ResultsURL,
+		"raw_results_url":    run.RawResultsURL,
+		"time_start":         formatTime(run.TimeStart),
+		"time_end":           formatTime(run.TimeEnd),
+	}
+}
+
+// diff returns the events of a migration of the run from before to after, at
+// the given time: label additions and removals, and field changes.
+func diff(source string, before, after *shared.TestRun, now time.Time) []Event {
+	events := make([]Event, 0)
+	seen := make(map[string]bool)
+	for _, label := range after.Labels {
+		if !seen[label] && !contains(before.Labels, label) {
+			events = append(events, Event{Label: label, Action: Added, Source: source, Time: now})
+		}
+		seen[label] = true
+	}
+	for _, label := range before.Labels {
+		if !seen[label] {
+			events = append(events, Event{Label: label, Action: Removed, Source: source, Time: now})
+		}
+		seen[label] = true
+	}
+
+	from, to := fields(before), fields(after)
+	names := make([]string, 0, len(from))
+	for name := range from {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if from[name] != to[name] {
+			events = append(events, Event{Field: name, From: from[name], To: to[name], Action: Changed, Source: source, Time: now})
+		}
+	}
+	return events
+}
+
+// Update records the changes of a migration of the run from before to after.
+// The labels before are attributed to Untracked if the run has no provenance
+// record yet. Nothing is written if neither the labels nor the tracked fields
+// changed.
+func Update(tx *datastore.Transaction, runKey *datastore.Key, source string, before, after *shared.TestRun) error {
+	events := diff(source, before, after, time.Now().UTC())
+	if len(events) == 0 {
+		return nil
+	}
+
+	history, found, err := Load(tx, runKey)
+	if err != nil {
+		return err
+	}
+	if !found {
+		history.Events = baseline(before.Labels, Untracked, time.Time{})
+	}
+	history.Events = append(history.Events, events...)
+	_, err = tx.Put(Key(runKey), &history)
+	return err
+}
+
+// Explain returns the event that added each of the given (current) labels,
+// i.e. the latest event for the label. Labels missing from the history are
+// attributed to Untracked.
+func (h History) Explain(labels []string) map[string]Event {
+	explanations := make(map[string]Event, len(labels))
+	for _, label := range labels {
+		explanations[label] = Event{Label: label, Action: Added, Source: Untracked}
+	}
+	for _, event := range h.Events {
+		if event.Action == Added && contains(labels, event.Label) {
+			explanations[event.Label] = event
+		}
+	}
+	return explanations
+}
+
+// Changes returns the field changes, oldest first. The From of the first
+// change of a field is its original value.
+func (h History) Changes() []Event {
+	changes := make([]Event, 0)
+	for _, event := range h.Events {
+		if event.Action == Changed {
+			changes = append(changes, event)
+		}
+	}
+	return changes
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package provenance
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2019, 1, 10, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2019, 1, 9, 13, 0, 0, 0, time.UTC)
+	before := shared.TestRun{Labels: []string{"chrome", "stable"}, TimeStart: start}
+	before.BrowserVersion = "70"
+	after := shared.TestRun{Labels: []string{"chrome", "experimental", "experimental"}, TimeStart: start.Add(-3 * time.Hour)}
+	after.BrowserVersion = "70.0.3538.77"
+
+	expected := []Event{
+		{Label: "experimental", Action: Added, Source: "test", Time: now},
+		{Label: "stable", Action: Removed, Source: "test", Time: now},
+		{Field: "browser_version", From: "70", To: "70.0.3538.77", Action: Changed, Source: "test", Time: now},
+		{Field: "time_start", From: "2019-01-09T13:00:00Z", To: "2019-01-09T10:00:00Z", Action: Changed, Source: "test", Time: now},
+	}
+	if events := diff("test", &before, &after, now); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, events)
+	}
+	if events := diff("test", &before, &before, now); len(events) != 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+}
+
+func TestExplainAndChanges(t *testing.T) {
+	added := Event{Label: "stable", Action: Added, Source: "channels"}
+	changed := Event{Field: "browser_version", From: "70", To: "70.0.3538.77", Action: Changed, Source: "versions"}
+	h := History{Events: []Event{added, changed}}
+
+	explanations := h.Explain([]string{"stable", "chrome"})
+	if explanations["stable"] != added {
+		t.Errorf("expected %+v, got %+v", added, explanations["stable"])
+	}
+	if explanations["chrome"].Source != Untracked {
+		t.Errorf("expected chrome to be %s, got %+v", Untracked, explanations["chrome"])
+	}
+	if changes := h.Changes(); !reflect.DeepEqual(changes, []Event{changed}) {
+		t.Errorf("expected %+v, got %+v", []Event{changed}, changes)
+	}
+}
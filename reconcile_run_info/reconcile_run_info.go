@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/osname"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var authority = flag.String("authority", "", "Comma-separated field=side pairs making either side authoritative for a field, e.g. browser_version=report,os_name=datastore; fields not listed are only reported")
+
+const gcsPrefix = "https://storage.googleapis.com/"
+
+// Sides of a discrepancy.
+const (
+	reportSide    = "report"
+	datastoreSide = "datastore"
+)
+
+// field is a product field that is both on TestRuns and in the run_info of
+// their raw reports.
+type field struct {
+	Name string
+	// RunInfoKeys are the run_info keys of the field, in order of precedence:
+	// wpt.fyi's own keys, then wptrunner's.
+	RunInfoKeys []string
+	get         func(run *shared.TestRun) string
+	set         func(run *shared.TestRun, value string)
+}
+
+var fields = []field{
+	{
+		Name:        "browser_name",
+		RunInfoKeys: []string{"browser_name", "product"},
+		get: func(run *shared.TestRun) string {
+			return strings.TrimSuffix(run.BrowserName, "-experimental")
+		},
+		set: func(run *shared.TestRun, value string) {
+			if strings.HasSuffix(run.BrowserName, "-experimental") {
+				value += "-experimental"
+			}
+			run.BrowserName = value
+		},
+	},
+	{
+		Name:        "browser_version",
+		RunInfoKeys: []string{"browser_version"},
+		get:         func(run *shared.TestRun) string { return run.BrowserVersion },
+		set: func(run *shared.TestRun, value string) {
+			// Keep the channel hint the uploader may have added, e.g. " dev".
+			if i := strings.Index(run.BrowserVersion, " "); i >= 0 && !strings.Contains(value, " ") {
+				value += run.BrowserVersion[i:]
+			}
+			run.BrowserVersion = value
+		},
+	},
+	{
+		Name:        "os_name",
+		RunInfoKeys: []string{"os_name", "os"},
+		get:         func(run *shared.TestRun) string { return run.OSName },
+		set:         func(run *shared.TestRun, value string) { run.OSName = value },
+	},
+	{
+		Name:        "os_version",
+		RunInfoKeys: []string{"os_version"},
+		get:         func(run *shared.TestRun) string { return run.OSVersion },
+		set:         func(run *shared.TestRun, value string) { run.OSVersion = value },
+	},
+}
+
+// same reports whether a Datastore value matches the report value. Versions
+// only need to match up to the channel hint, e.g. "70.0.3538.9 dev" matches
+// "70.0.3538.9".
+func (f field) same(ds, rep string) bool {
+	ds, rep = strings.TrimSpace(ds), strings.TrimSpace(rep)
+	if ds == rep {
+		return true
+	}
+	return f.Name == "browser_version" && strings.HasPrefix(ds, rep+" ")
+}
+
+func fieldByName(name string) (field, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// discrepancy is a field whose value on a TestRun differs from its report.
+type discrepancy struct {
+	ID        int64  `json:"id"`
+	Field     string `json:"field"`
+	Datastore string `json:"datastore"`
+	Report    string `json:"report"`
+	// Resolved is the side that was made authoritative, if any.
+	Resolved string `json:"resolved,omitempty"`
+}
+
+type discrepancyReport struct {
+	Counts        map[string]int   `json:"counts"`
+	Discrepancies []discrepancy    `json:"discrepancies"`
+	Failures      map[int64]string `json:"failures"`
+	// Cleanup lists the commands that delete the reports replaced by
+	// reconciled copies, to be run once the migration has been verified.
+	Cleanup []string `json:"cleanup"`
+	// Orphans lists the commands that delete the reconciled copies written
+	// for runs that were not pointed at them after all.
+	Orphans []string `json:"orphans"`
+}
+
+// reconciliation is the prefetched state of a run.
+type reconciliation struct {
+	Discrepancies []discrepancy
+	// OldURL is the RawResultsURL the report was fetched from, and NewURL
+	// the URL of its reconciled copy, if any run_info field is to be updated
+	// (with Updates).
+	OldURL  string
+	NewURL  string
+	Updates map[string]string
+}
+
+// runInfoReconciler compares the product metadata of runs with the run_info
+// of their raw reports, and (per --authority) updates either side. Reports are
+// never modified: a reconciled copy is written next to the original right
+// before the run is processed (outside of its transaction), and the run is
+// pointed at it.
+type runInfoReconciler struct {
+	// Authority maps field names to the authoritative side.
+	Authority map[string]string
+	GCS       *storage.Client
+	// OSTable normalizes the OS on both sides before comparing them.
+	OSTable osname.Table
+	// Suffix distinguishes the reconciled copies of reports written by this
+	// invocation, e.g. report-reconciled-1540000000.json.
+	Suffix string
+
+	mutex           *sync.Mutex
+	reconciliations map[int64]reconciliation
+	// Written reconciled copies, by run ID.
+	written map[int64]string
+	// Replaced reports, by the ID of the run that was pointed at a copy.
+	replaced map[int64]string
+	failures map[int64]string
+}
+
+// compare returns the discrepancies between the run and the run_info of its
+// report.
+func (r runInfoReconciler) compare(run *shared.TestRun, runInfo map[string]interface{}) []discrepancy {
+	reported := make(map[string]string)
+	for _, f := range fields {
+		for _, key := range f.RunInfoKeys {
+			if reported[f.Name] = report.RunInfoString(runInfo, key); reported[f.Name] != "" {
+				break
+			}
+		}
+	}
+	// The OS is compared in its canonical form (as os_names.go normalizes
+	// TestRuns), e.g. wptrunner's "win" matches "windows", and the report side
+	// is copied to TestRuns in that form.
+	ds, _, _ := r.OSTable.Normalize(osname.Release{Name: run.OSName, Version: run.OSVersion})
+	rep, _, _ := r.OSTable.Normalize(osname.Release{Name: reported["os_name"], Version: reported["os_version"]})
+	normalized := map[string][2]string{
+		"os_name":    {ds.Name, rep.Name},
+		"os_version": {ds.Version, rep.Version},
+	}
+
+	found := make([]discrepancy, 0)
+	for _, f := range fields {
+		value := reported[f.Name]
+		// Missing run_info fields are not discrepancies; there is nothing to
+		// compare (or copy) then.
+		if value == "" {
+			continue
+		}
+		current := f.get(run)
+		if n, ok := normalized[f.Name]; ok {
+			current, value = n[0], n[1]
+		}
+		if f.same(current, value) {
+			continue
+		}
+		found = append(found, discrepancy{
+			ID:        run.ID,
+			Field:     f.Name,
+			Datastore: f.get(run),
+			Report:    value,
+			Resolved:  r.Authority[f.Name],
+		})
+	}
+	return found
+}
+
+// runInfoUpdates returns the run_info values to write for the discrepancies
+// resolved in favor of Datastore. Only the primary (first) key of each field
+// is written, so that e.g. wptrunner's own product and os keys stay as they
+// are.
+func runInfoUpdates(found []discrepancy) map[string]string {
+	updates := make(map[string]string)
+	for _, d := range found {
+		if d.Resolved != datastoreSide {
+			continue
+		}
+		f, _ := fieldByName(d.Field)
+		value := d.Datastore
+		// run_info versions have no channel hint.
+		if f.Name == "browser_version" {
+			value = strings.SplitN(value, " ", 2)[0]
+		}
+		updates[f.RunInfoKeys[0]] = value
+	}
+	return updates
+}
+
+var reportSuffix = regexp.MustCompile(`(-reconciled-\d+)?\.json$`)
+
+// gcsObject returns the bucket and object name of a GCS URL.
+func gcsObject(url string) (bucket, object string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(url, gcsPrefix), "/", 2)
+	if !strings.HasPrefix(url, gcsPrefix) || len(parts) != 2 {
+		return "", "", fmt.Errorf("Raw report %s is not in GCS", url)
+	}
+	return parts[0], parts[1], nil
+}
+
+// reconciledURL returns the URL of the reconciled copy of the report at url.
+func (r runInfoReconciler) reconciledURL(url string) (string, error) {
+	if _, _, err := gcsObject(url); err != nil {
+		return "", err
+	}
+	if !reportSuffix.MatchString(url) {
+		return "", fmt.Errorf("Unrecognized report URL %s", url)
+	}
+	return reportSuffix.ReplaceAllString(url, "-reconciled-"+r.Suffix+".json"), nil
+}
+
+// writeReport writes a copy of the raw report to url, with the given run_info
+// fields overwritten and everything else kept as is.
+func (r runInfoReconciler) writeReport(url string, raw report.Raw, runInfo map[string]interface{}, updates map[string]string) error {
+	bucket, object, err := gcsObject(url)
+	if err != nil {
+		return err
+	}
+	for key, value := range updates {
+		runInfo[key] = value
+	}
+	if raw["run_info"], err = json.Marshal(runInfo); err != nil {
+		return err
+	}
+
+	writer := r.GCS.Bucket(bucket).Object(object).NewWriter(context.Background())
+	writer.ContentType = "application/json"
+	if err := json.NewEncoder(writer).Encode(raw); err != nil {
+		writer.CloseWithError(err)
+		return err
+	}
+	log.Printf("Wrote run_info %v to %s", updates, url)
+	return writer.Close()
+}
+
+// Prefetch fetches the raw report of each run, and compares it with the run.
+// The reports are not kept; those with discrepancies resolved in favor of
+// Datastore are fetched again by Prepare, only for the runs processed.
+func (r runInfoReconciler) Prefetch(runs []shared.TestRun) {
+	candidates := make([]shared.TestRun, 0, len(runs))
+	for _, run := range runs {
+		if run.RawResultsURL != "" {
+			candidates = append(candidates, run)
+		}
+	}
+	failures := report.ForEach(candidates, func(run shared.TestRun) error {
+		raw, err := report.FetchRaw(run.RawResultsURL)
+		if err != nil {
+			return err
+		}
+		runInfo, err := raw.RunInfo()
+		if err != nil {
+			return err
+		}
+		rec := reconciliation{
+			Discrepancies: r.compare(&run, runInfo),
+			OldURL:        run.RawResultsURL,
+		}
+		if rec.Updates = runInfoUpdates(rec.Discrepancies); len(rec.Updates) > 0 {
+			if rec.NewURL, err = r.reconciledURL(run.RawResultsURL); err != nil {
+				return err
+			}
+		}
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.reconciliations[run.ID] = rec
+		return nil
+	})
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id, err := range failures {
+		r.failures[id] = err
+	}
+}
+
+// reconciliation returns the prefetched state of the run; ok is false if its
+// report was not fetched, or the run was pointed at another report since.
+func (r runInfoReconciler) reconciliation(run *shared.TestRun) (rec reconciliation, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	rec, ok = r.reconciliations[run.ID]
+	return rec, ok && rec.OldURL == run.RawResultsURL
+}
+
+func (r runInfoReconciler) ShouldProcessRun(run *shared.TestRun) bool {
+	rec, ok := r.reconciliation(run)
+	if !ok {
+		return false
+	}
+	for _, d := range rec.Discrepancies {
+		if d.Resolved != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepare writes the reconciled copy of the run's report, if it needs one
+// (once, as the run's transaction may be retried). The copy is reported as an
+// orphan unless the run is then pointed at it (see Committed).
+func (r runInfoReconciler) Prepare(run *shared.TestRun) error {
+	rec, ok := r.reconciliation(run)
+	r.mutex.Lock()
+	_, written := r.written[run.ID]
+	r.mutex.Unlock()
+	if !ok || rec.NewURL == "" || written {
+		return nil
+	}
+	raw, err := report.FetchRaw(rec.OldURL)
+	if err != nil {
+		return err
+	}
+	runInfo, err := raw.RunInfo()
+	if err != nil {
+		return err
+	}
+	if err := r.writeReport(rec.NewURL, raw, runInfo, rec.Updates); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.written[run.ID] = rec.NewURL
+	return nil
+}
+
+func (r runInfoReconciler) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	rec, ok := r.reconciliation(run)
+	if !ok {
+		return fmt.Errorf("TestRun %d was not compared with its report", run.ID)
+	}
+	r.mutex.Lock()
+	written := r.written[run.ID]
+	r.mutex.Unlock()
+	if rec.NewURL != "" && written != rec.NewURL {
+		// Prepare did not write the copy.
+		return processor.ConditionUnsatisfied{}
+	}
+	for _, d := range rec.Discrepancies {
+		if d.Resolved == reportSide {
+			f, _ := fieldByName(d.Field)
+			f.set(run, d.Report)
+		}
+	}
+	if rec.NewURL != "" {
+		log.Printf("TestRun %d: RawResultsURL %s -> %s", run.ID, run.RawResultsURL, rec.NewURL)
+		run.RawResultsURL = rec.NewURL
+	}
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Committed records the report replaced by the reconciled copy of the run.
+func (r runInfoReconciler) Committed(run *shared.TestRun) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if rec, ok := r.reconciliations[run.ID]; ok && rec.NewURL != "" && run.RawResultsURL == rec.NewURL {
+		r.replaced[run.ID] = rec.OldURL
+	}
+}
+
+// Report lists all discrepancies (and how they were resolved), their number
+// per field, the runs whose report could not be fetched (or reconciled), the
+// commands to delete the replaced reports, and those to delete the reconciled
+// copies that no run was pointed at.
+func (r runInfoReconciler) Report() interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := discrepancyReport{
+		Counts:        make(map[string]int),
+		Discrepancies: make([]discrepancy, 0),
+		Failures:      r.failures,
+		Cleanup:       make([]string, 0, len(r.replaced)),
+		Orphans:       make([]string, 0),
+	}
+	for _, rec := range r.reconciliations {
+		for _, d := range rec.Discrepancies {
+			result.Counts[d.Field]++
+			result.Discrepancies = append(result.Discrepancies, d)
+		}
+	}
+	// To be safe, the replaced reports are not deleted right away.
+	for _, url := range r.replaced {
+		result.Cleanup = append(result.Cleanup, "gsutil rm gs://"+strings.TrimPrefix(url, gcsPrefix))
+	}
+	for id, url := range r.written {
+		if _, ok := r.replaced[id]; !ok {
+			result.Orphans = append(result.Orphans, "gsutil rm gs://"+strings.TrimPrefix(url, gcsPrefix))
+		}
+	}
+	return result
+}
+
+func parseAuthority(s string) map[string]string {
+	authorities := make(map[string]string)
+	if s == "" {
+		return authorities
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || (parts[1] != reportSide && parts[1] != datastoreSide) {
+			log.Fatalf("Invalid --authority %s: expected field=report or field=datastore", pair)
+		}
+		if _, known := fieldByName(parts[0]); !known {
+			log.Fatalf("Invalid --authority %s: unknown field %s", pair, parts[0])
+		}
+		authorities[parts[0]] = parts[1]
+	}
+	return authorities
+}
+
+func main() {
+	flag.Parse()
+	profile.Apply(map[string]string{"project": "project"})
+	gcs, err := clients.NewStorage(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	table, err := osname.LoadTable()
+	if err != nil {
+		log.Fatalf("Failed to load OS table: %s", err.Error())
+	}
+	processor.MigrateData(runInfoReconciler{
+		Authority:       parseAuthority(*authority),
+		GCS:             gcs,
+		OSTable:         table,
+		Suffix:          strconv.FormatInt(time.Now().Unix(), 10),
+		mutex:           &sync.Mutex{},
+		reconciliations: make(map[int64]reconciliation),
+		written:         make(map[int64]string),
+		replaced:        make(map[int64]string),
+		failures:        make(map[int64]string),
+	})
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"context"
+	"flag"
+	"sync"
+
+	"github.com/web-platform-tests/wpt.fyi/shared"
+	"golang.org/x/sync/semaphore"
+)
+
+var fetchConcurrency = flag.Int64("fetch-concurrency", 20, "Number of raw reports or results summaries fetched concurrently")
+
+// ForEach calls fetch for each of the runs, at most --fetch-concurrency at a
+// time, and returns the errors by run ID. Unlike FetchAll, the calls are
+// concurrent.
+func ForEach(runs []shared.TestRun, fetch func(run shared.TestRun) error) map[int64]string {
+	var mutex sync.Mutex
+	failures := make(map[int64]string)
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(*fetchConcurrency)
+	for _, run := range runs {
+		sem.Acquire(ctx, 1)
+		go func(run shared.TestRun) {
+			defer sem.Release(1)
+			if err := fetch(run); err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				failures[run.ID] = err.Error()
+			}
+		}(run)
+	}
+	sem.Acquire(ctx, *fetchConcurrency)
+	return failures
+}
+
+// FetchAll downloads the raw reports of the runs (skipping runs without one),
+// at most --fetch-concurrency at a time, and calls f with each run and its
+// report. The calls of f are serialized, so f may update maps without locking;
+// it should only keep what it needs of the report, as reports are large. It
+// returns the errors of the reports that could not be fetched, by run ID.
+//
+// Processors should fetch reports this way before processing runs, rather
+// than in ShouldProcessRun, which is called in a transaction.
+func FetchAll(runs []shared.TestRun, f func(run shared.TestRun, r *Report)) map[int64]string {
+	var mutex sync.Mutex
+	return ForEach(runs, func(run shared.TestRun) error {
+		if run.RawResultsURL == "" {
+			return nil
+		}
+		r, err := Fetch(run.RawResultsURL)
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		f(run, r)
+		return nil
+	})
+}
+
+// FetchAllSummaries is like FetchAll, for the results summaries of the runs.
+func FetchAllSummaries(runs []shared.TestRun, f func(run shared.TestRun, summary map[string][]int)) map[int64]string {
+	var mutex sync.Mutex
+	return ForEach(runs, func(run shared.TestRun) error {
+		if run.ResultsURL == "" {
+			return nil
+		}
+		summary, err := FetchSummary(run.ResultsURL)
+		if err != nil {
+			return err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		f(run, summary)
+		return nil
+	})
+}
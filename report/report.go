@@ -0,0 +1,172 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/results-analysis/metrics"
+)
+
+// Report is a raw wptreport (as referenced by a TestRun's RawResultsURL).
+// Unlike metrics.TestResultsReport, it keeps all of the run_info fields
+// reported by wptrunner, and the time span of the run.
+type Report struct {
+	Results []*metrics.TestResults `json:"results"`
+	RunInfo map[string]interface{} `json:"run_info"`
+	// TimeStart and TimeEnd are in milliseconds since the epoch; 0 if missing.
+	TimeStart float64 `json:"time_start"`
+	TimeEnd   float64 `json:"time_end"`
+}
+
+// Fetch downloads and parses the raw report at the given URL (from the GCS
+// emulator, if one is configured).
+func Fetch(url string) (*Report, error) {
+	var report Report
+	if err := get(url, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// get downloads the JSON at the given URL (from the GCS emulator, if one is
+// configured) into v.
+func get(url string, v interface{}) error {
+	resp, err := http.Get(clients.ResultsURL(url))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Non-OK HTTP status code of %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Raw is a raw report as its top-level JSON fields, for rewriting parts of
+// it while keeping everything else as is.
+type Raw map[string]json.RawMessage
+
+// FetchRaw downloads the raw report at the given URL without parsing its
+// fields.
+func FetchRaw(url string) (Raw, error) {
+	var raw Raw
+	if err := get(url, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// RunInfo parses the run_info of the raw report; empty if it has none.
+func (r Raw) RunInfo() (map[string]interface{}, error) {
+	info := make(map[string]interface{})
+	if len(r["run_info"]) > 0 {
+		if err := json.Unmarshal(r["run_info"], &info); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// FetchSummary downloads and parses the results summary at the given URL
+// (a TestRun's ResultsURL), which maps each test to its numbers of passing
+// and total subtests.
+func FetchSummary(url string) (map[string][]int, error) {
+	var summary map[string][]int
+	if err := get(url, &summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// RunInfoString returns the run_info field as a string; "" if it is missing
+// or not a string.
+func (r *Report) RunInfoString(field string) string {
+	return RunInfoString(r.RunInfo, field)
+}
+
+// RunInfoString returns the field of the given run_info as a string; "" if it
+// is missing or not a string.
+func RunInfoString(runInfo map[string]interface{}, field string) string {
+	s, _ := runInfo[field].(string)
+	return s
+}
+
+// Start returns the time_start of the report; the zero time if missing.
+func (r *Report) Start() time.Time {
+	return millis(r.TimeStart)
+}
+
+// End returns the time_end of the report; the zero time if missing.
+func (r *Report) End() time.Time {
+	return millis(r.TimeEnd)
+}
+
+func millis(ms float64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()
+}
+
+// FailureStatuses are the statuses of tests and subtests that typically come
+// from a broken environment rather than from the browser under test.
+var FailureStatuses = []string{"TIMEOUT", "ERROR", "CRASH"}
+
+// IsFailureStatus reports whether the status is one of FailureStatuses.
+func IsFailureStatus(status string) bool {
+	for _, s := range FailureStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Histogram counts tests and subtests by status.
+type Histogram map[string]int
+
+// Statuses returns the histogram of the statuses of the report's tests and
+// subtests.
+func (r *Report) Statuses() Histogram {
+	h := make(Histogram)
+	for _, result := range r.Results {
+		h[result.Status]++
+		for _, subtest := range result.Subtests {
+			h[subtest.Status]++
+		}
+	}
+	return h
+}
+
+// Total returns the number of tests and subtests.
+func (h Histogram) Total() int {
+	total := 0
+	for _, n := range h {
+		total += n
+	}
+	return total
+}
+
+// Failures returns the number of tests and subtests with FailureStatuses.
+func (h Histogram) Failures() int {
+	failures := 0
+	for status, n := range h {
+		if IsFailureStatus(status) {
+			failures += n
+		}
+	}
+	return failures
+}
+
+// FailureRatio returns the fraction of tests and subtests with
+// FailureStatuses; 0 if there are none at all.
+func (h Histogram) FailureRatio() float64 {
+	total := h.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(h.Failures()) / float64(total)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// alignedGroup identifies the runs of one revision on one channel.
+type alignedGroup struct {
+	Revision string
+	Channel  string
+}
+
+// alignedLabeller labels runs 'aligned' when the default browsers all have a
+// run of the same revision on the same channel, and removes the label from
+// runs of groups that (no longer) qualify.
+type alignedLabeller struct {
+	// AlignedRuns contains the IDs of the runs to be labelled 'aligned'.
+	AlignedRuns mapset.Set
+	// Revisions lists the aligned revisions by channel, for the report.
+	Revisions map[string][]string
+}
+
+// alignmentChannel returns the channel used to group the run, or "" if the run
+// has no channel label.
+func alignmentChannel(run shared.TestRun) string {
+	labels := run.LabelsSet()
+	if labels.Contains("experimental") || strings.HasSuffix(run.BrowserName, "-experimental") {
+		return "experimental"
+	} else if labels.Contains("beta") {
+		return "beta"
+	} else if labels.Contains("stable") {
+		return "stable"
+	}
+	return ""
+}
+
+func newAlignedLabeller(runs []shared.TestRun) alignedLabeller {
+	defaultBrowsers := mapset.NewSet()
+	for _, b := range shared.GetDefaultBrowserNames() {
+		defaultBrowsers.Add(b)
+	}
+
+	groups := make(map[alignedGroup][]shared.TestRun)
+	for _, run := range runs {
+		browser := strings.TrimSuffix(run.BrowserName, "-experimental")
+		channel := alignmentChannel(run)
+		if run.FullRevisionHash == "" || channel == "" || !defaultBrowsers.Contains(browser) {
+			continue
+		}
+		g := alignedGroup{run.FullRevisionHash, channel}
+		groups[g] = append(groups[g], run)
+	}
+
+	a := alignedLabeller{
+		AlignedRuns: mapset.NewSet(),
+		Revisions:   make(map[string][]string),
+	}
+	for g, group := range groups {
+		browsers := mapset.NewSet()
+		for _, run := range group {
+			browsers.Add(strings.TrimSuffix(run.BrowserName, "-experimental"))
+		}
+		if !browsers.Equal(defaultBrowsers) {
+			continue
+		}
+		for _, run := range group {
+			a.AlignedRuns.Add(run.ID)
+		}
+		a.Revisions[g.Channel] = append(a.Revisions[g.Channel], g.Revision)
+	}
+	for _, revisions := range a.Revisions {
+		sort.Strings(revisions)
+	}
+	return a
+}
+
+func (a alignedLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	return a.AlignedRuns.Contains(run.ID) != run.LabelsSet().Contains("aligned")
+}
+
+func (a alignedLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	if a.AlignedRuns.Contains(run.ID) {
+		run.Labels = append(run.Labels, "aligned")
+	} else {
+		labels := make([]string, 0, len(run.Labels))
+		for _, label := range run.Labels {
+			if label != "aligned" {
+				labels = append(labels, label)
+			}
+		}
+		run.Labels = labels
+	}
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the aligned revisions by channel.
+func (a alignedLabeller) Report() interface{} {
+	return a.Revisions
+}
+
+func main() {
+	processor.MigrateData(newAlignedLabeller(processor.LoadRuns()))
+}
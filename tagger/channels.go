@@ -1,10 +1,9 @@
 package main
 
 import (
-	"strings"
-
 	"cloud.google.com/go/datastore"
 
+	"github.com/web-platform-tests/data-migration/channel"
 	"github.com/web-platform-tests/data-migration/processor"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 )
@@ -15,7 +14,7 @@ var channels = []string{"stable", "release", "beta", "dev", "canary", "nightly",
 type channelLabeller struct{}
 
 func (e channelLabeller) ShouldProcessRun(run *shared.TestRun) bool {
-	if !shared.IsBrowserName(run.BrowserName) {
+	if !channel.Known(run.BrowserName) {
 		return false
 	}
 	labels := run.LabelsSet()
@@ -24,34 +23,22 @@ func (e channelLabeller) ShouldProcessRun(run *shared.TestRun) bool {
 			return false
 		}
 	}
-	return true
+	_, ok := channel.Infer(run.BrowserName, run.BrowserVersion)
+	return ok
 }
 
 func (e channelLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
-	switch run.BrowserName {
-	case "chrome":
-		if strings.HasSuffix(run.BrowserVersion, " dev") {
-			run.Labels = append(run.Labels, "dev")
-		} else if strings.HasSuffix(run.BrowserVersion, " beta") {
-			run.Labels = append(run.Labels, "beta")
-		}
-	case "firefox":
-		if strings.HasSuffix(run.BrowserVersion, "a1") {
-			run.Labels = append(run.Labels, "nightly")
-		} else if strings.HasSuffix(run.BrowserVersion, "b1") {
-			run.Labels = append(run.Labels, "beta")
-		}
-	case "safari":
-		if strings.Contains(run.BrowserVersion, "preview") || strings.Contains(run.BrowserVersion, "Preview") {
-			run.Labels = append(run.Labels, "preview")
-		}
-	default:
-		return nil
-	}
+	c, _ := channel.Infer(run.BrowserName, run.BrowserVersion)
+	run.Labels = append(run.Labels, c)
 	_, err := tx.Put(key, run)
 	return err
 }
 
+// Report lists the browser versions that matched no channel pattern.
+func (e channelLabeller) Report() interface{} {
+	return channel.Unmatched()
+}
+
 func main() {
 	processor.MigrateData(channelLabeller{})
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/ci"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var minConfidence = flag.String("min-confidence", "high", "Only label runs classified with at least this confidence (medium or high)")
+var fetchReports = flag.Bool("fetch-reports", true, "Fetch the raw report of runs that their URLs do not classify with high confidence, to inspect its run_info")
+
+// classifiedRun is reported for each run with no CI source label.
+type classifiedRun struct {
+	ID            int64  `json:"id"`
+	RawResultsURL string `json:"raw_results_url"`
+	ci.Classification
+	Labelled bool `json:"labelled"`
+}
+
+type ciSourceReport struct {
+	Classified   []classifiedRun `json:"classified"`
+	Unclassified []classifiedRun `json:"unclassified"`
+}
+
+// ciSourceLabeller labels runs with the CI system they originated from
+// (azure, buildbot or taskcluster), as inferred by the ci package.
+type ciSourceLabeller struct {
+	MinConfidence ci.Confidence
+
+	mutex *sync.Mutex
+	// The run_info of the prefetched reports, by run ID.
+	runInfos map[int64]map[string]interface{}
+	// Classifications by run ID.
+	runs map[int64]classifiedRun
+}
+
+// needsReport reports whether the run's URLs do not classify it with high
+// confidence, so that the run_info of its report is needed.
+func needsReport(run *shared.TestRun) bool {
+	return !ci.HasSourceLabel(run) && run.RawResultsURL != "" && ci.Classify(run, nil).Confidence < ci.High
+}
+
+// Prefetch fetches the reports of the runs that need them (unless
+// --fetch-reports=false), keeping only their run_info.
+func (c ciSourceLabeller) Prefetch(runs []shared.TestRun) {
+	if !*fetchReports {
+		return
+	}
+	candidates := make([]shared.TestRun, 0)
+	for i := range runs {
+		if needsReport(&runs[i]) {
+			candidates = append(candidates, runs[i])
+		}
+	}
+	failures := report.FetchAll(candidates, func(run shared.TestRun, r *report.Report) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.runInfos[run.ID] = r.RunInfo
+	})
+	for id, err := range failures {
+		log.Printf("WARN: Failed to fetch the report of TestRun %d: %s", id, err)
+	}
+}
+
+func (c ciSourceLabeller) classify(run *shared.TestRun) classifiedRun {
+	c.mutex.Lock()
+	classified, ok := c.runs[run.ID]
+	c.mutex.Unlock()
+	if ok {
+		return classified
+	}
+
+	classification := ci.Classify(run, nil)
+	c.mutex.Lock()
+	runInfo, fetched := c.runInfos[run.ID]
+	c.mutex.Unlock()
+	if classification.Confidence < ci.High && fetched {
+		classification = ci.Classify(run, runInfo)
+	}
+	classified = classifiedRun{
+		ID:             run.ID,
+		RawResultsURL:  run.RawResultsURL,
+		Classification: classification,
+		Labelled:       classification.Confidence >= c.MinConfidence,
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.runs[run.ID] = classified
+	return classified
+}
+
+func (c ciSourceLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	if ci.HasSourceLabel(run) {
+		return false
+	}
+	return c.classify(run).Labelled
+}
+
+func (c ciSourceLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	classified := c.classify(run)
+	run.Labels = append(run.Labels, classified.Source)
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the classification of each run without a CI source label
+// (including those below --min-confidence), and the runs that could not be
+// classified at all.
+func (c ciSourceLabeller) Report() interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result := ciSourceReport{
+		Classified:   make([]classifiedRun, 0),
+		Unclassified: make([]classifiedRun, 0),
+	}
+	for _, run := range c.runs {
+		if run.Source == "" {
+			result.Unclassified = append(result.Unclassified, run)
+		} else {
+			result.Classified = append(result.Classified, run)
+		}
+	}
+	return result
+}
+
+func main() {
+	flag.Parse()
+	confidence, err := ci.ParseConfidence(*minConfidence)
+	if err != nil || confidence == ci.None {
+		log.Fatalf("Invalid --min-confidence %s", *minConfidence)
+	}
+	processor.MigrateData(ciSourceLabeller{
+		MinConfidence: confidence,
+		mutex:         &sync.Mutex{},
+		runInfos:      make(map[int64]map[string]interface{}),
+		runs:          make(map[int64]classifiedRun),
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/wptgit"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// epoch is a periodic boundary of wpt master, e.g. every day at 00:00 UTC.
+// Label is named after the corresponding branch of the wpt repository.
+type epoch struct {
+	Label  string
+	Period time.Duration
+}
+
+// Epochs are aligned to the zero time.Time, which is a Monday, 00:00 UTC.
+var epochs = []epoch{
+	{"epochs/hourly", time.Hour},
+	{"epochs/six_hourly", 6 * time.Hour},
+	{"epochs/daily", 24 * time.Hour},
+	{"epochs/weekly", 7 * 24 * time.Hour},
+}
+
+// epochLabeller labels runs of epochal revisions, i.e. the revisions master
+// pointed at when an epoch started, with the corresponding epoch labels.
+type epochLabeller struct {
+	// Revisions resolves (possibly abbreviated) revisions of master commits.
+	Revisions *wptgit.Index
+	// Epochs maps the full hashes of epochal revisions to their epoch labels.
+	Epochs map[string][]string
+}
+
+// epochalRevisions computes, for each epochal commit of the master history
+// (newest first), the epochs it starts: a commit starts an epoch if the next
+// commit on master landed in a later epoch.
+func epochalRevisions(history []wptgit.Commit) map[string][]string {
+	revisions := make(map[string][]string)
+	for i := 1; i < len(history); i++ {
+		commit, next := history[i], history[i-1]
+		for _, e := range epochs {
+			if commit.Time.Truncate(e.Period).Before(next.Time.Truncate(e.Period)) {
+				revisions[commit.Hash] = append(revisions[commit.Hash], e.Label)
+			}
+		}
+	}
+	return revisions
+}
+
+func (e epochLabeller) missingEpochs(run *shared.TestRun) []string {
+	revision := run.FullRevisionHash
+	if revision == "" {
+		revision = run.Revision
+	}
+	hash, err := e.Revisions.Resolve(revision)
+	if err != nil {
+		return nil
+	}
+	labels := run.LabelsSet()
+	missing := make([]string, 0)
+	for _, label := range e.Epochs[hash] {
+		if !labels.Contains(label) {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
+
+func (e epochLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	return len(e.missingEpochs(run)) > 0
+}
+
+func (e epochLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	run.Labels = append(run.Labels, e.missingEpochs(run)...)
+	_, err := tx.Put(key, run)
+	return err
+}
+
+func main() {
+	flag.Parse()
+	history, err := wptgit.MasterHistory(wptgit.Open())
+	if err != nil {
+		log.Fatalf("Failed to scrape master revisions: %s", err.Error())
+	}
+	hashes := make([]string, 0, len(history))
+	for _, commit := range history {
+		hashes = append(hashes, commit.Hash)
+	}
+	processor.MigrateData(epochLabeller{
+		Revisions: wptgit.NewIndex(hashes),
+		Epochs:    epochalRevisions(history),
+	})
+}
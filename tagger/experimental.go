@@ -6,25 +6,25 @@ import (
 	"cloud.google.com/go/datastore"
 	mapset "github.com/deckarep/golang-set"
 
+	"github.com/web-platform-tests/data-migration/channel"
 	"github.com/web-platform-tests/data-migration/processor"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 )
 
 // experimentalLabeller ensures that experimental runs are labelled
-// 'experimental' (and not 'stable'), based on the browser name and version.
+// 'experimental' (and not 'stable'), based on the browser name and the channel
+// inferred from its version.
 type experimentalLabeller struct{}
 
 func (e experimentalLabeller) ShouldProcessRun(run *shared.TestRun) bool {
-	if !shared.IsBrowserName(run.BrowserName) {
+	if !channel.Known(run.BrowserName) {
 		return false
 	}
 	if strings.HasSuffix(run.BrowserName, "-experimental") {
 		return true
 	}
-	if strings.HasSuffix(run.BrowserVersion, " dev") || strings.HasSuffix(run.BrowserVersion, "a1") {
-		return true
-	}
-	return false
+	c, ok := channel.Infer(run.BrowserName, run.BrowserVersion)
+	return ok && channel.IsExperimental(c)
 }
 
 func (e experimentalLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
@@ -42,6 +42,11 @@ func (e experimentalLabeller) ProcessRun(tx *datastore.Transaction, key *datasto
 	return err
 }
 
+// Report lists the browser versions that matched no channel pattern.
+func (e experimentalLabeller) Report() interface{} {
+	return channel.Unmatched()
+}
+
 func main() {
 	processor.MigrateData(experimentalLabeller{})
 }
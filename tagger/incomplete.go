@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	minCoverage = flag.Float64("min-coverage", 0.9, "Label runs with fewer than this fraction of the expected number of tests 'incomplete'")
+	window      = flag.Duration("window", 7*24*time.Hour, "Time window (of TimeStart) within which runs of a browser are compared")
+	minPeers    = flag.Int("min-peers", 3, "Minimum number of runs of a browser in a window to compute the expected number of tests")
+	countFrom   = flag.String("count-from", "summary", "Count tests in the results summary (summary) or the raw report (report)")
+)
+
+const incomplete = "incomplete"
+
+// coverage is the audit record of a run compared with its peers.
+type coverage struct {
+	ID       int64   `json:"id"`
+	Browser  string  `json:"browser"`
+	Window   string  `json:"window"`
+	Tests    int     `json:"tests"`
+	Expected int     `json:"expected"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// incompleteLabeller labels runs 'incomplete' when they have far fewer tests
+// than other runs of the same browser at about the same time, and removes the
+// label from runs that (no longer) qualify. The tests of the runs to process
+// and of their peers are counted in Prefetch, i.e. for each pass (and each
+// batch of new runs in --watch mode).
+type incompleteLabeller struct {
+	// Coverage by run ID, for the runs that could be compared.
+	Coverage map[int64]coverage
+	// Failures lists the runs whose tests could not be counted.
+	Failures map[int64]string
+
+	// All runs by ID, including new runs in --watch mode, and the numbers of
+	// tests of those counted so far.
+	runs   map[int64]shared.TestRun
+	counts map[int64]int
+}
+
+// countTests counts the tests of each run, per --count-from.
+func countTests(runs []shared.TestRun) (map[int64]int, map[int64]string) {
+	counts := make(map[int64]int)
+	if *countFrom == "report" {
+		return counts, report.FetchAll(runs, func(run shared.TestRun, r *report.Report) {
+			counts[run.ID] = len(r.Results)
+		})
+	}
+	return counts, report.FetchAllSummaries(runs, func(run shared.TestRun, summary map[string][]int) {
+		counts[run.ID] = len(summary)
+	})
+}
+
+func median(values []int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// peerGroup is the browser and window of runs compared with each other.
+type peerGroup struct {
+	Browser string
+	Window  time.Time
+}
+
+func peerGroupOf(run shared.TestRun) peerGroup {
+	start := run.TimeStart
+	if start.IsZero() {
+		start = run.CreatedAt
+	}
+	return peerGroup{strings.TrimSuffix(run.BrowserName, "-experimental"), start.Truncate(*window)}
+}
+
+func newIncompleteLabeller(runs []shared.TestRun) incompleteLabeller {
+	labeller := incompleteLabeller{
+		Coverage: make(map[int64]coverage),
+		Failures: make(map[int64]string),
+		runs:     make(map[int64]shared.TestRun, len(runs)),
+		counts:   make(map[int64]int),
+	}
+	for _, run := range runs {
+		labeller.runs[run.ID] = run
+	}
+	return labeller
+}
+
+// Prefetch counts the tests of the runs about to be processed and of their
+// peers (those not counted yet), and compares the runs with their peers.
+func (l incompleteLabeller) Prefetch(selected []shared.TestRun) {
+	wanted := make(map[peerGroup]bool)
+	for _, run := range selected {
+		l.runs[run.ID] = run
+		wanted[peerGroupOf(run)] = true
+	}
+	groups := make(map[peerGroup][]shared.TestRun)
+	toCount := make([]shared.TestRun, 0)
+	for _, run := range l.runs {
+		g := peerGroupOf(run)
+		if !wanted[g] {
+			continue
+		}
+		groups[g] = append(groups[g], run)
+		_, counted := l.counts[run.ID]
+		_, failed := l.Failures[run.ID]
+		if !counted && !failed {
+			toCount = append(toCount, run)
+		}
+	}
+	counts, failures := countTests(toCount)
+	for id, count := range counts {
+		l.counts[id] = count
+	}
+	for id, err := range failures {
+		l.Failures[id] = err
+	}
+
+	// The expected number of tests of a group of runs is the median, which
+	// incomplete (or unusually large) runs do not skew.
+	expected := make(map[peerGroup]int)
+	for g, peers := range groups {
+		peerCounts := make([]int, 0, len(peers))
+		for _, run := range peers {
+			if count, ok := l.counts[run.ID]; ok {
+				peerCounts = append(peerCounts, count)
+			}
+		}
+		if len(peerCounts) >= *minPeers {
+			expected[g] = median(peerCounts)
+		}
+	}
+	for _, run := range selected {
+		g := peerGroupOf(run)
+		count, counted := l.counts[run.ID]
+		if !counted || expected[g] == 0 {
+			delete(l.Coverage, run.ID)
+			continue
+		}
+		l.Coverage[run.ID] = coverage{
+			ID:       run.ID,
+			Browser:  g.Browser,
+			Window:   g.Window.UTC().Format(time.RFC3339),
+			Tests:    count,
+			Expected: expected[g],
+			Ratio:    float64(count) / float64(expected[g]),
+		}
+	}
+}
+
+func (l incompleteLabeller) isIncomplete(run *shared.TestRun) (bool, bool) {
+	c, ok := l.Coverage[run.ID]
+	return ok && c.Ratio < *minCoverage, ok
+}
+
+func (l incompleteLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	isIncomplete, ok := l.isIncomplete(run)
+	return ok && isIncomplete != run.LabelsSet().Contains(incomplete)
+}
+
+func (l incompleteLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	isIncomplete, _ := l.isIncomplete(run)
+	labels := make([]string, 0, len(run.Labels)+1)
+	for _, label := range run.Labels {
+		if label != incomplete {
+			labels = append(labels, label)
+		}
+	}
+	if isIncomplete {
+		c := l.Coverage[run.ID]
+		log.Printf("TestRun %d (%s): %d of %d expected tests", run.ID, c.Browser, c.Tests, c.Expected)
+		labels = append(labels, incomplete)
+	}
+	run.Labels = labels
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the coverage of the incomplete runs, and the runs whose tests
+// could not be counted.
+func (l incompleteLabeller) Report() interface{} {
+	runs := make([]coverage, 0)
+	for _, c := range l.Coverage {
+		if c.Ratio < *minCoverage {
+			runs = append(runs, c)
+		}
+	}
+	return map[string]interface{}{
+		"incomplete": runs,
+		"failures":   l.Failures,
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *countFrom != "summary" && *countFrom != "report" {
+		log.Fatal(fmt.Errorf("Invalid --count-from %s", *countFrom))
+	}
+	processor.MigrateData(newIncompleteLabeller(processor.LoadRuns()))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/osname"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// osChange is the audit record of a normalized run.
+type osChange struct {
+	ID   int64          `json:"id"`
+	From osname.Release `json:"from"`
+	To   osname.Release `json:"to"`
+}
+
+type osReport struct {
+	Changes []osChange `json:"changes"`
+	// Unknown variants, with the number of runs of each.
+	UnknownNames    map[string]int `json:"unknown_names"`
+	UnknownVersions map[string]int `json:"unknown_versions"`
+}
+
+// osNormalizer canonicalizes the OSName and OSVersion of runs.
+type osNormalizer struct {
+	Table osname.Table
+
+	mutex           *sync.Mutex
+	changes         map[int64]osChange
+	unknownNames    map[int64]string
+	unknownVersions map[int64]string
+}
+
+// normalize returns the canonical OS of the run. Unknown names or versions
+// are left as they are (and recorded for the report).
+func (n osNormalizer) normalize(run *shared.TestRun) osname.Release {
+	normalized, nameKnown, versionKnown := n.Table.Normalize(osname.Release{Name: run.OSName, Version: run.OSVersion})
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.unknownNames, run.ID)
+	delete(n.unknownVersions, run.ID)
+	if !nameKnown {
+		n.unknownNames[run.ID] = run.OSName
+	} else if !versionKnown {
+		n.unknownVersions[run.ID] = normalized.Name + " " + run.OSVersion
+	}
+	return normalized
+}
+
+func (n osNormalizer) ShouldProcessRun(run *shared.TestRun) bool {
+	normalized := n.normalize(run)
+	if normalized.Name == run.OSName && normalized.Version == run.OSVersion {
+		return false
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.changes[run.ID] = osChange{
+		ID:   run.ID,
+		From: osname.Release{Name: run.OSName, Version: run.OSVersion},
+		To:   normalized,
+	}
+	return true
+}
+
+func (n osNormalizer) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	normalized := n.normalize(run)
+	log.Printf("TestRun %d: OS %s %s -> %s %s", run.ID, run.OSName, run.OSVersion, normalized.Name, normalized.Version)
+	run.OSName = normalized.Name
+	run.OSVersion = normalized.Version
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the original OS of each normalized run, and the OS names and
+// versions that are missing from the table.
+func (n osNormalizer) Report() interface{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	report := osReport{
+		Changes:         make([]osChange, 0, len(n.changes)),
+		UnknownNames:    make(map[string]int),
+		UnknownVersions: make(map[string]int),
+	}
+	for _, change := range n.changes {
+		report.Changes = append(report.Changes, change)
+	}
+	for _, name := range n.unknownNames {
+		report.UnknownNames[name]++
+	}
+	for _, version := range n.unknownVersions {
+		report.UnknownVersions[version]++
+	}
+	return report
+}
+
+func main() {
+	flag.Parse()
+	table, err := osname.LoadTable()
+	if err != nil {
+		log.Fatalf("Failed to load OS table: %s", err.Error())
+	}
+	processor.MigrateData(osNormalizer{
+		Table:           table,
+		mutex:           &sync.Mutex{},
+		changes:         make(map[int64]osChange),
+		unknownNames:    make(map[int64]string),
+		unknownVersions: make(map[int64]string),
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/derived"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/wptgit"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var deriveMaster = flag.Bool("derive-master", true, "Derive master labels (requires the WPT checkout, see --wpt_git_path)")
+
+// labelChange is the audit record of a reconciled run.
+type labelChange struct {
+	ID     int64    `json:"id"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+// labelReconciler rewrites the labels of each run to its canonical labels
+// (see derived.Canonical), whatever order the individual taggers would have
+// run in.
+type labelReconciler struct {
+	Master *derived.MasterRevisions
+
+	mutex   *sync.Mutex
+	changes map[int64]labelChange
+}
+
+func (r labelReconciler) ShouldProcessRun(run *shared.TestRun) bool {
+	canonical := derived.Canonical(run, r.Master)
+	if derived.SameSet(run.Labels, canonical) {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.changes[run.ID] = labelChange{ID: run.ID, Before: run.Labels, After: canonical}
+	return true
+}
+
+func (r labelReconciler) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	canonical := derived.Canonical(run, r.Master)
+	log.Printf("TestRun %d: labels %v -> %v", run.ID, run.Labels, canonical)
+	run.Labels = canonical
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the labels of each changed run before and after reconciling.
+func (r labelReconciler) Report() interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	changes := make([]labelChange, 0, len(r.changes))
+	for _, change := range r.changes {
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func main() {
+	flag.Parse()
+	var master *derived.MasterRevisions
+	if *deriveMaster {
+		var err error
+		if master, err = derived.LoadMasterRevisions(wptgit.Open()); err != nil {
+			log.Fatalf("Failed to scrape master revisions: %s", err.Error())
+		}
+	}
+	processor.MigrateData(labelReconciler{
+		Master:  master,
+		mutex:   &sync.Mutex{},
+		changes: make(map[int64]labelChange),
+	})
+}
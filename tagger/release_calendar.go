@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/channel"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var calendarPath *string
+
+func init() {
+	_, srcFilePath, _, ok := runtime.Caller(0)
+	if !ok {
+		log.Fatal(errors.New("Failed to get golang source file path"))
+	}
+	defaultCalendar := filepath.Clean(path.Dir(srcFilePath) + "/release_calendar.json")
+	calendarPath = flag.String("calendar", defaultCalendar, "Path to the JSON release calendar")
+}
+
+// calendarChannels are the channel labels managed by the release calendar.
+// The calendar has no canary track (canary builds overlap with dev), so runs
+// labelled canary are left alone.
+var calendarChannels = []string{"stable", "beta", "dev", "nightly", "preview"}
+
+// release is an entry of the release calendar: the major version of a browser
+// was on the given channel from From (inclusive) to To (exclusive). Dates are
+// formatted as YYYY-MM-DD, in UTC.
+type release struct {
+	Browser string `json:"browser"`
+	Major   int    `json:"major"`
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+
+	from time.Time
+	to   time.Time
+}
+
+// unknownRelease is reported for runs whose channel the calendar does not
+// know: either it does not cover their version or time, or their version was
+// on no channel at the time of the run. It is also reported for runs whose
+// version names another channel than the calendar's (Hint and Calendar).
+type unknownRelease struct {
+	ID             int64     `json:"id"`
+	BrowserName    string    `json:"browser_name"`
+	BrowserVersion string    `json:"browser_version"`
+	TimeStart      time.Time `json:"time_start"`
+	Labels         []string  `json:"labels"`
+	Hint           string    `json:"hint,omitempty"`
+	Calendar       string    `json:"calendar,omitempty"`
+}
+
+// releaseCalendarLabeller verifies (and adds or corrects) the channel label of
+// each run against an offline release calendar, using the major browser
+// version and TimeStart of the run.
+type releaseCalendarLabeller struct {
+	// Releases by browser name and major version.
+	Releases map[string]map[int][]release
+
+	mutex *sync.Mutex
+	// Runs outside of the calendar's coverage, by ID.
+	uncovered map[int64]unknownRelease
+	// Runs whose version was on no channel, by ID.
+	noChannel map[int64]unknownRelease
+	// Runs whose version names another channel than the calendar's, by ID.
+	conflicts map[int64]unknownRelease
+}
+
+var majorVersion = regexp.MustCompile(`^\d+`)
+
+func loadCalendar(path string) map[string]map[int][]release {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read release calendar: %s", err.Error())
+	}
+	var entries []release
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		log.Fatalf("Failed to parse release calendar: %s", err.Error())
+	}
+	releases := make(map[string]map[int][]release)
+	for _, r := range entries {
+		if r.from, err = time.Parse("2006-01-02", r.From); err != nil {
+			log.Fatalf("Invalid release calendar entry %v: %s", r, err.Error())
+		}
+		if r.to, err = time.Parse("2006-01-02", r.To); err != nil {
+			log.Fatalf("Invalid release calendar entry %v: %s", r, err.Error())
+		}
+		if releases[r.Browser] == nil {
+			releases[r.Browser] = make(map[int][]release)
+		}
+		releases[r.Browser][r.Major] = append(releases[r.Browser][r.Major], r)
+	}
+	return releases
+}
+
+// covered reports whether the calendar covers the major version of the
+// browser at the given time, i.e. it lists the version and does not end
+// before then.
+func covered(majors map[int][]release, major int, t time.Time) bool {
+	if len(majors[major]) == 0 {
+		return false
+	}
+	for _, releases := range majors {
+		for _, r := range releases {
+			if t.Before(r.to) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// channelAt returns the channel the run's browser version was on at the time
+// of the run. ok is false if the calendar does not cover the browser, or the
+// run lacks the metadata to look it up.
+func (c releaseCalendarLabeller) channelAt(run *shared.TestRun) (ch string, ok bool) {
+	browser := strings.TrimSuffix(run.BrowserName, "-experimental")
+	majors, known := c.Releases[browser]
+	if !known || run.TimeStart.IsZero() {
+		return "", false
+	}
+	major, err := strconv.Atoi(majorVersion.FindString(run.BrowserVersion))
+	if err != nil {
+		return "", false
+	}
+	for _, r := range majors[major] {
+		if !run.TimeStart.Before(r.from) && run.TimeStart.Before(r.to) {
+			return r.Channel, true
+		}
+	}
+
+	u := unknownRelease{
+		ID:             run.ID,
+		BrowserName:    run.BrowserName,
+		BrowserVersion: run.BrowserVersion,
+		TimeStart:      run.TimeStart,
+		Labels:         run.Labels,
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if covered(majors, major, run.TimeStart) {
+		c.noChannel[run.ID] = u
+	} else {
+		c.uncovered[run.ID] = u
+	}
+	return "", false
+}
+
+// expectedChannel returns the calendar's channel of the run, unless the
+// run's version names a different channel (e.g. "64.0a1" on a merge day), in
+// which case the conflict is reported and ok is false.
+func (c releaseCalendarLabeller) expectedChannel(run *shared.TestRun) (ch string, ok bool) {
+	ch, ok = c.channelAt(run)
+	if !ok {
+		return "", false
+	}
+	if hint, explicit := channel.Hint(run.BrowserName, run.BrowserVersion); explicit && hint != ch {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.conflicts[run.ID] = unknownRelease{
+			ID:             run.ID,
+			BrowserName:    run.BrowserName,
+			BrowserVersion: run.BrowserVersion,
+			TimeStart:      run.TimeStart,
+			Labels:         run.Labels,
+			Hint:           hint,
+			Calendar:       ch,
+		}
+		return "", false
+	}
+	return ch, true
+}
+
+func (c releaseCalendarLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	labels := run.LabelsSet()
+	if labels.Contains("canary") {
+		return false
+	}
+	ch, ok := c.expectedChannel(run)
+	if !ok {
+		return false
+	}
+	// As in stable.go and experimental.go, -experimental builds are never
+	// stable, stable runs are not experimental and dev, nightly and preview
+	// runs are.
+	if ch == channel.Stable {
+		if strings.HasSuffix(run.BrowserName, "-experimental") {
+			return false
+		}
+		if labels.Contains("experimental") {
+			return true
+		}
+	} else if channel.IsExperimental(ch) && !labels.Contains("experimental") {
+		return true
+	}
+	if !labels.Contains(ch) {
+		return true
+	}
+	for _, other := range calendarChannels {
+		if other != ch && labels.Contains(other) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c releaseCalendarLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	ch, _ := c.expectedChannel(run)
+	labels := make([]string, 0, len(run.Labels)+2)
+	for _, label := range run.Labels {
+		if ch == channel.Stable && label == "experimental" {
+			continue
+		}
+		if label == ch || !contains(calendarChannels, label) {
+			labels = append(labels, label)
+		}
+	}
+	if channel.IsExperimental(ch) && !contains(labels, "experimental") {
+		labels = append(labels, "experimental")
+	}
+	if !contains(labels, ch) {
+		labels = append(labels, ch)
+	}
+	log.Printf("TestRun %d (%s %s at %v): labels %v -> %v", run.ID, run.BrowserName, run.BrowserVersion, run.TimeStart, run.Labels, labels)
+	run.Labels = labels
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the runs outside of the calendar's coverage (which it should be
+// extended for), those whose version was on no channel at the time of the run,
+// and those whose version names another channel (which are left alone).
+func (c releaseCalendarLabeller) Report() interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	list := func(runs map[int64]unknownRelease) []unknownRelease {
+		l := make([]unknownRelease, 0, len(runs))
+		for _, u := range runs {
+			l = append(l, u)
+		}
+		return l
+	}
+	return map[string][]unknownRelease{
+		"uncovered":  list(c.uncovered),
+		"no_channel": list(c.noChannel),
+		"conflicts":  list(c.conflicts),
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	flag.Parse()
+	processor.MigrateData(releaseCalendarLabeller{
+		Releases:  loadCalendar(*calendarPath),
+		mutex:     &sync.Mutex{},
+		uncovered: make(map[int64]unknownRelease),
+		noChannel: make(map[int64]unknownRelease),
+		conflicts: make(map[int64]unknownRelease),
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var mappingPath = flag.String("mapping", "", "Path to a JSON object mapping old labels to new labels (or to \"\" to remove them)")
+
+// labelCounts is the report of labelRenamer: the number of runs carrying each
+// label before and after the migration.
+type labelCounts struct {
+	Before map[string]int `json:"before"`
+	After  map[string]int `json:"after"`
+}
+
+// labelRenamer renames, merges and removes labels according to a mapping.
+type labelRenamer struct {
+	Mapping map[string]string
+
+	mutex *sync.Mutex
+	// Labels before and after renaming, by run ID.
+	before map[int64][]string
+	after  map[int64][]string
+}
+
+// rename applies the mapping to the labels, dropping removed labels and
+// duplicates (keeping the first occurrence).
+func (l labelRenamer) rename(labels []string) []string {
+	seen := make(map[string]bool)
+	renamed := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if newLabel, ok := l.Mapping[label]; ok {
+			label = newLabel
+		}
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		renamed = append(renamed, label)
+	}
+	return renamed
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (l labelRenamer) ShouldProcessRun(run *shared.TestRun) bool {
+	renamed := l.rename(run.Labels)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.before[run.ID] = run.Labels
+	l.after[run.ID] = renamed
+	return !equal(run.Labels, renamed)
+}
+
+func (l labelRenamer) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	run.Labels = l.rename(run.Labels)
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report counts the runs carrying each label before and after renaming.
+func (l labelRenamer) Report() interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	counts := labelCounts{
+		Before: make(map[string]int),
+		After:  make(map[string]int),
+	}
+	for _, labels := range l.before {
+		for _, label := range labels {
+			counts.Before[label]++
+		}
+	}
+	for _, labels := range l.after {
+		for _, label := range labels {
+			counts.After[label]++
+		}
+	}
+	return counts
+}
+
+func main() {
+	flag.Parse()
+	if *mappingPath == "" {
+		log.Fatal("--mapping is required")
+	}
+	bytes, err := ioutil.ReadFile(*mappingPath)
+	if err != nil {
+		log.Fatalf("Failed to read label mapping: %s", err.Error())
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(bytes, &mapping); err != nil {
+		log.Fatalf("Failed to parse label mapping: %s", err.Error())
+	}
+	processor.MigrateData(labelRenamer{
+		Mapping: mapping,
+		mutex:   &sync.Mutex{},
+		before:  make(map[int64][]string),
+		after:   make(map[int64][]string),
+	})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// Policies for picking the primary run of a group of reruns.
+const (
+	latestPolicy       = "latest"
+	mostTestsPolicy    = "most-tests"
+	fewestErrorsPolicy = "fewest-errors"
+)
+
+var primaryPolicy = flag.String("primary", latestPolicy, "How to pick the primary run of runs of the same product and revision: latest, most-tests or fewest-errors")
+
+const rerun = "rerun"
+
+// rerunStats are the numbers of tests and subtests of a run, and of those
+// with report.FailureStatuses.
+type rerunStats struct {
+	Tests  int `json:"tests"`
+	Errors int `json:"errors"`
+}
+
+// rerunGroup is the audit record of a group of runs of the same product,
+// revision and kind.
+type rerunGroup struct {
+	Product      string                `json:"product"`
+	Revision     string                `json:"revision"`
+	Kind         string                `json:"kind,omitempty"`
+	Experimental bool                  `json:"experimental,omitempty"`
+	Primary      int64                 `json:"primary"`
+	Reruns       []int64               `json:"reruns"`
+	Stats        map[int64]*rerunStats `json:"stats,omitempty"`
+}
+
+// rerunLabeller labels all but the primary run of each group of runs of the
+// same browser, version, OS and revision 'rerun' (rather than deleting them,
+// as dedup_runs does for runs of the same report), and removes the label from
+// primary runs and from runs that are (no longer) in a group. PR runs
+// (pr_base, pr_head) are only compared with PR runs of the same kind, master
+// runs with master runs, and experimental runs with experimental runs.
+type rerunLabeller struct {
+	// Primary is true for the primary runs and false for the reruns, by ID,
+	// and true for runs labelled rerun without reruns; other runs without
+	// reruns are absent.
+	Primary map[int64]bool
+	Groups  []rerunGroup
+	// Unlabelled lists the runs labelled rerun that are in no group.
+	Unlabelled []int64
+	// Failures lists the runs whose report could not be fetched. Groups with
+	// such runs are skipped.
+	Failures map[int64]string
+}
+
+// rerunKinds are the labels of runs that are only reruns of runs with the
+// same label: PR runs cover only the tests affected by the PR, unlike full
+// runs of the same revision on master.
+var rerunKinds = []string{"pr_base", "pr_head", "master"}
+
+// rerunKey returns the product, revision, kind (one of rerunKinds, or empty)
+// and whether the run is experimental; ok is false for runs without a
+// revision. The revision is the 10-character abbreviation used by Revision, so
+// that runs with and without a FullRevisionHash are grouped together.
+func rerunKey(run shared.TestRun) (product, revision, kind string, experimental, ok bool) {
+	revision = run.Revision
+	if revision == "" {
+		revision = run.FullRevisionHash
+	}
+	if len(revision) > 10 {
+		revision = revision[:10]
+	}
+	labels := run.LabelsSet()
+	for _, k := range rerunKinds {
+		if labels.Contains(k) {
+			kind = k
+			break
+		}
+	}
+	experimental = labels.Contains("experimental") || strings.HasSuffix(run.BrowserName, "-experimental")
+	product = fmt.Sprintf("%s-%s-%s-%s", run.BrowserName, run.BrowserVersion, run.OSName, run.OSVersion)
+	return product, revision, kind, experimental, revision != ""
+}
+
+func fetchRerunStats(runs []shared.TestRun) (map[int64]*rerunStats, map[int64]string) {
+	stats := make(map[int64]*rerunStats)
+	failures := report.FetchAll(runs, func(run shared.TestRun, r *report.Report) {
+		h := r.Statuses()
+		stats[run.ID] = &rerunStats{Tests: h.Total(), Errors: h.Failures()}
+	})
+	return stats, failures
+}
+
+func newRerunLabeller(runs []shared.TestRun) rerunLabeller {
+	type groupKey struct {
+		Product, Revision, Kind string
+		Experimental            bool
+	}
+	groups := make(map[groupKey][]shared.TestRun)
+	labeller := rerunLabeller{
+		Primary:    make(map[int64]bool),
+		Groups:     make([]rerunGroup, 0),
+		Unlabelled: make([]int64, 0),
+		Failures:   make(map[int64]string),
+	}
+	for _, run := range runs {
+		if product, revision, kind, experimental, ok := rerunKey(run); ok {
+			k := groupKey{product, revision, kind, experimental}
+			groups[k] = append(groups[k], run)
+		} else if run.LabelsSet().Contains(rerun) {
+			labeller.Primary[run.ID] = true
+			labeller.Unlabelled = append(labeller.Unlabelled, run.ID)
+		}
+	}
+
+	var stats map[int64]*rerunStats
+	if *primaryPolicy != latestPolicy {
+		toFetch := make([]shared.TestRun, 0)
+		for _, group := range groups {
+			if len(group) > 1 {
+				toFetch = append(toFetch, group...)
+			}
+		}
+		stats, labeller.Failures = fetchRerunStats(toFetch)
+	}
+
+	for k, group := range groups {
+		if len(group) < 2 {
+			if run := group[0]; run.LabelsSet().Contains(rerun) {
+				labeller.Primary[run.ID] = true
+				labeller.Unlabelled = append(labeller.Unlabelled, run.ID)
+			}
+			continue
+		}
+		if stats != nil {
+			complete := true
+			for _, run := range group {
+				_, ok := stats[run.ID]
+				complete = complete && ok
+			}
+			if !complete {
+				log.Printf("Skipping %s@%s: not all reports could be fetched", k.Product, k.Revision)
+				continue
+			}
+		}
+		// The primary run sorts first; ties fall back to the latest run.
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := group[i], group[j]
+			switch *primaryPolicy {
+			case mostTestsPolicy:
+				if stats[a.ID].Tests != stats[b.ID].Tests {
+					return stats[a.ID].Tests > stats[b.ID].Tests
+				}
+			case fewestErrorsPolicy:
+				if stats[a.ID].Errors != stats[b.ID].Errors {
+					return stats[a.ID].Errors < stats[b.ID].Errors
+				}
+			}
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+			return a.ID > b.ID
+		})
+
+		g := rerunGroup{
+			Product:      k.Product,
+			Revision:     k.Revision,
+			Kind:         k.Kind,
+			Experimental: k.Experimental,
+			Primary:      group[0].ID,
+			Reruns:       make([]int64, 0, len(group)-1),
+		}
+		if stats != nil {
+			g.Stats = make(map[int64]*rerunStats)
+		}
+		for i, run := range group {
+			labeller.Primary[run.ID] = i == 0
+			if i > 0 {
+				g.Reruns = append(g.Reruns, run.ID)
+			}
+			if stats != nil {
+				g.Stats[run.ID] = stats[run.ID]
+			}
+		}
+		labeller.Groups = append(labeller.Groups, g)
+	}
+	return labeller
+}
+
+func (l rerunLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	primary, ok := l.Primary[run.ID]
+	return ok && primary == run.LabelsSet().Contains(rerun)
+}
+
+func (l rerunLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	labels := make([]string, 0, len(run.Labels)+1)
+	for _, label := range run.Labels {
+		if label != rerun {
+			labels = append(labels, label)
+		}
+	}
+	if !l.Primary[run.ID] {
+		labels = append(labels, rerun)
+	}
+	run.Labels = labels
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the groups of reruns with their primary run, the runs labelled
+// rerun that are in no group, and the runs whose report could not be fetched.
+func (l rerunLabeller) Report() interface{} {
+	return map[string]interface{}{
+		"policy":     *primaryPolicy,
+		"groups":     l.Groups,
+		"unlabelled": l.Unlabelled,
+		"failures":   l.Failures,
+	}
+}
+
+func main() {
+	flag.Parse()
+	switch *primaryPolicy {
+	case latestPolicy, mostTestsPolicy, fewestErrorsPolicy:
+	default:
+		log.Fatalf("Invalid --primary %s: expected latest, most-tests or fewest-errors", *primaryPolicy)
+	}
+	processor.MigrateData(newRerunLabeller(processor.LoadRuns()))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var runInfoMappingPath *string
+
+func init() {
+	_, srcFilePath, _, ok := runtime.Caller(0)
+	if !ok {
+		log.Fatal(errors.New("Failed to get golang source file path"))
+	}
+	defaultMapping := filepath.Clean(path.Dir(srcFilePath) + "/run_info_labels.json")
+	runInfoMappingPath = flag.String("run-info-mapping", defaultMapping, "Path to the JSON mapping from run_info values to labels")
+}
+
+// runInfoRule labels runs whose report's run_info has the given key, with the
+// given value (or matching the given pattern; any value if neither is set).
+// Values other than strings are compared in their JSON encoding, e.g. "true"
+// or "[\"reftest\"]".
+type runInfoRule struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Label   string `json:"label"`
+
+	pattern *regexp.Regexp
+}
+
+func (r runInfoRule) matches(runInfo map[string]interface{}) bool {
+	v, ok := runInfo[r.Key]
+	if !ok {
+		return false
+	}
+	value, ok := v.(string)
+	if !ok {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		value = string(encoded)
+	}
+	switch {
+	case r.Value != "":
+		return value == r.Value
+	case r.pattern != nil:
+		return r.pattern.MatchString(value)
+	}
+	return true
+}
+
+// runInfoLabeller adds the labels of the rules matching the run_info of each
+// run's raw report. It never removes labels.
+type runInfoLabeller struct {
+	Rules []runInfoRule
+
+	mutex *sync.Mutex
+	// Missing labels, by run ID.
+	missing  map[int64][]string
+	failures map[int64]string
+}
+
+func loadRunInfoRules(path string) []runInfoRule {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read run_info mapping: %s", err.Error())
+	}
+	var rules []runInfoRule
+	if err := json.Unmarshal(bytes, &rules); err != nil {
+		log.Fatalf("Failed to parse run_info mapping: %s", err.Error())
+	}
+	for i, r := range rules {
+		if r.Key == "" || r.Label == "" {
+			log.Fatalf("Invalid run_info mapping rule %v: key and label are required", r)
+		}
+		if r.Pattern != "" {
+			if rules[i].pattern, err = regexp.Compile(r.Pattern); err != nil {
+				log.Fatalf("Invalid run_info mapping rule %v: %s", r, err.Error())
+			}
+		}
+	}
+	return rules
+}
+
+// missingLabels returns the labels of the matching rules that the run lacks.
+func (l runInfoLabeller) missingLabels(run *shared.TestRun, r *report.Report) []string {
+	labels := run.LabelsSet()
+	missing := make([]string, 0)
+	for _, rule := range l.Rules {
+		if rule.matches(r.RunInfo) && !labels.Contains(rule.Label) {
+			labels.Add(rule.Label)
+			missing = append(missing, rule.Label)
+		}
+	}
+	return missing
+}
+
+// Prefetch fetches the raw reports of the runs and computes the labels they
+// lack, outside of transactions.
+func (l runInfoLabeller) Prefetch(runs []shared.TestRun) {
+	failures := report.FetchAll(runs, func(run shared.TestRun, r *report.Report) {
+		missing := l.missingLabels(&run, r)
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.missing[run.ID] = missing
+	})
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for id, err := range failures {
+		l.failures[id] = err
+	}
+}
+
+// stillMissing returns the labels the run lacked when prefetched, and still
+// lacks; ok is false if its report was not fetched.
+func (l runInfoLabeller) stillMissing(run *shared.TestRun) (missing []string, ok bool) {
+	l.mutex.Lock()
+	prefetched, ok := l.missing[run.ID]
+	l.mutex.Unlock()
+	labels := run.LabelsSet()
+	for _, label := range prefetched {
+		if !labels.Contains(label) {
+			missing = append(missing, label)
+		}
+	}
+	return missing, ok
+}
+
+func (l runInfoLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	missing, ok := l.stillMissing(run)
+	return ok && len(missing) > 0
+}
+
+func (l runInfoLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	missing, _ := l.stillMissing(run)
+	run.Labels = append(run.Labels, missing...)
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report counts the runs missing each label, and lists the runs whose report
+// could not be fetched.
+func (l runInfoLabeller) Report() interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	counts := make(map[string]int)
+	for _, missing := range l.missing {
+		for _, label := range missing {
+			counts[label]++
+		}
+	}
+	return map[string]interface{}{
+		"missing_labels": counts,
+		"failures":       l.failures,
+	}
+}
+
+func main() {
+	flag.Parse()
+	processor.MigrateData(runInfoLabeller{
+		Rules:    loadRunInfoRules(*runInfoMappingPath),
+		mutex:    &sync.Mutex{},
+		missing:  make(map[int64][]string),
+		failures: make(map[int64]string),
+	})
+}
@@ -6,34 +6,47 @@ import (
 	"cloud.google.com/go/datastore"
 	mapset "github.com/deckarep/golang-set"
 
+	"github.com/web-platform-tests/data-migration/channel"
 	"github.com/web-platform-tests/data-migration/processor"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 )
 
 // stableLabeller ensures that stable runs are labelled 'stable' (and not
-// 'experimental'), based on the browser name and version.
+// 'experimental'), based on the browser name and the channel inferred from its
+// version. Beta runs are not stable (they used to be labelled so before the
+// channel table); the label is removed from runs whose version names another
+// channel, e.g. "63.0b12".
 type stableLabeller struct{}
 
-func (e stableLabeller) ShouldProcessRun(run *shared.TestRun) bool {
-	if !shared.IsBrowserName(run.BrowserName) {
-		return false
-	}
-	if strings.HasSuffix(run.BrowserName, "-experimental") {
-		return false
+// isStable reports whether the run is stable; ok is false if that is unknown.
+func isStable(run *shared.TestRun) (stable, ok bool) {
+	if !channel.Known(run.BrowserName) || strings.HasSuffix(run.BrowserName, "-experimental") {
+		return false, false
 	}
-	if strings.HasSuffix(run.BrowserVersion, " dev") || strings.HasSuffix(run.BrowserVersion, "a1") {
-		return false
+	if c, ok := channel.Infer(run.BrowserName, run.BrowserVersion); ok && c == channel.Stable {
+		return true, true
 	}
-	return true
+	c, explicit := channel.Hint(run.BrowserName, run.BrowserVersion)
+	return false, explicit && c != channel.Stable
+}
+
+func (e stableLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	stable, ok := isStable(run)
+	return ok && (stable || run.LabelsSet().Contains("stable"))
 }
 
 func (e stableLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	stable, _ := isStable(run)
 	labels := mapset.NewSet()
 	for _, label := range run.Labels {
 		labels.Add(label)
 	}
-	labels.Remove("experimental")
-	labels.Add("stable")
+	if stable {
+		labels.Remove("experimental")
+		labels.Add("stable")
+	} else {
+		labels.Remove("stable")
+	}
 	run.Labels = nil
 	for label := range labels.Iter() {
 		run.Labels = append(run.Labels, label.(string))
@@ -42,6 +55,11 @@ func (e stableLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key
 	return err
 }
 
+// Report lists the browser versions that matched no channel pattern.
+func (e stableLabeller) Report() interface{} {
+	return channel.Unmatched()
+}
+
 func main() {
 	processor.MigrateData(stableLabeller{})
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/web-platform-tests/data-migration/channel"
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/report"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+var (
+	historySize = flag.Int("history", 10, "Number of preceding runs of the same product and channel each run is compared with")
+	minHistory  = flag.Int("min-history", 3, "Minimum number of preceding runs needed to judge a run")
+	sigma       = flag.Float64("sigma", 3, "Label runs whose failure ratio exceeds the mean of the preceding runs by more than this many standard deviations 'suspect'")
+	minIncrease = flag.Float64("min-increase", 0.1, "Minimum increase of the failure ratio over the mean of the preceding runs for a run to be 'suspect'")
+)
+
+const suspect = "suspect"
+
+// outlier is the audit record of a run compared with its preceding runs.
+type outlier struct {
+	ID        int64            `json:"id"`
+	Product   string           `json:"product"`
+	Histogram report.Histogram `json:"histogram"`
+	Ratio     float64          `json:"failure_ratio"`
+	Mean      float64          `json:"baseline_mean"`
+	StdDev    float64          `json:"baseline_stddev"`
+	Baseline  []int64          `json:"baseline_runs"`
+}
+
+// suspectLabeller labels runs 'suspect' when far more of their tests and
+// subtests time out, error or crash than in the preceding runs of the same
+// product and channel, and removes the label from runs that (no longer)
+// qualify. The reports of the runs to process and of their preceding runs are
+// fetched in Prefetch, i.e. for each pass (and each batch of new runs in
+// --watch mode).
+type suspectLabeller struct {
+	// Judged lists the runs that had enough history, by ID; Outliers the
+	// suspect ones among them.
+	Judged   map[int64]bool
+	Outliers map[int64]outlier
+	// Failures lists the runs whose report could not be fetched.
+	Failures map[int64]string
+
+	// All runs by ID, including new runs in --watch mode, and the status
+	// histograms of those fetched so far.
+	runs       map[int64]shared.TestRun
+	histograms map[int64]report.Histogram
+}
+
+func fetchHistograms(runs []shared.TestRun) (map[int64]report.Histogram, map[int64]string) {
+	histograms := make(map[int64]report.Histogram)
+	failures := report.FetchAll(runs, func(run shared.TestRun, r *report.Report) {
+		histograms[run.ID] = r.Statuses()
+	})
+	return histograms, failures
+}
+
+// product identifies the runs a run is compared with, e.g. "chrome dev".
+func product(run shared.TestRun) string {
+	name := strings.TrimSuffix(run.BrowserName, "-experimental")
+	c, _ := channel.Infer(run.BrowserName, run.BrowserVersion)
+	return strings.TrimSpace(name + " " + c)
+}
+
+// startedAt returns the TimeStart of the run, or its CreatedAt if unset.
+func startedAt(run shared.TestRun) time.Time {
+	if run.TimeStart.IsZero() {
+		return run.CreatedAt
+	}
+	return run.TimeStart
+}
+
+func meanAndStdDev(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+func newSuspectLabeller(runs []shared.TestRun) suspectLabeller {
+	labeller := suspectLabeller{
+		Judged:     make(map[int64]bool),
+		Outliers:   make(map[int64]outlier),
+		Failures:   make(map[int64]string),
+		runs:       make(map[int64]shared.TestRun, len(runs)),
+		histograms: make(map[int64]report.Histogram),
+	}
+	for _, run := range runs {
+		labeller.runs[run.ID] = run
+	}
+	return labeller
+}
+
+// Prefetch fetches the reports of the runs about to be processed and of up to
+// twice --history preceding runs of the same product each (those not fetched
+// yet; suspect runs are left out of the baseline), and judges the runs.
+// Overlapping histories are walked as one, so that judging all runs walks the
+// whole history of each product once.
+func (l suspectLabeller) Prefetch(selected []shared.TestRun) {
+	isSelected := make(map[int64]bool)
+	wanted := make(map[string]bool)
+	for _, run := range selected {
+		l.runs[run.ID] = run
+		isSelected[run.ID] = true
+		wanted[product(run)] = true
+	}
+	products := make(map[string][]shared.TestRun)
+	for _, run := range l.runs {
+		if name := product(run); wanted[name] {
+			products[name] = append(products[name], run)
+		}
+	}
+
+	lookback := 2 * *historySize
+	histories := make(map[string][][]shared.TestRun)
+	toFetch := make([]shared.TestRun, 0)
+	for name, productRuns := range products {
+		sort.Slice(productRuns, func(i, j int) bool {
+			if !startedAt(productRuns[i]).Equal(startedAt(productRuns[j])) {
+				return startedAt(productRuns[i]).Before(startedAt(productRuns[j]))
+			}
+			return productRuns[i].ID < productRuns[j].ID
+		})
+		start, end := -1, -1
+		for i, run := range productRuns {
+			if !isSelected[run.ID] {
+				continue
+			}
+			from := i - lookback
+			if from < 0 {
+				from = 0
+			}
+			if start >= 0 && from <= end {
+				end = i + 1
+				continue
+			}
+			if start >= 0 {
+				histories[name] = append(histories[name], productRuns[start:end])
+			}
+			start, end = from, i+1
+		}
+		if start >= 0 {
+			histories[name] = append(histories[name], productRuns[start:end])
+		}
+		for _, history := range histories[name] {
+			for _, run := range history {
+				_, fetched := l.histograms[run.ID]
+				_, failed := l.Failures[run.ID]
+				if !fetched && !failed {
+					toFetch = append(toFetch, run)
+				}
+			}
+		}
+	}
+	histograms, failures := fetchHistograms(toFetch)
+	for id, histogram := range histograms {
+		l.histograms[id] = histogram
+	}
+	for id, err := range failures {
+		l.Failures[id] = err
+	}
+
+	for name, productHistories := range histories {
+		for _, history := range productHistories {
+			l.judge(name, history, isSelected)
+		}
+	}
+}
+
+// judge compares each run of the (sorted) history of a product with the runs
+// preceding it, recording the result for the selected runs.
+func (l suspectLabeller) judge(name string, history []shared.TestRun, isSelected map[int64]bool) {
+	// The baseline is the preceding runs that are not suspect themselves,
+	// so that one broken run does not hide the next.
+	baseline := make([]shared.TestRun, 0)
+	for _, run := range history {
+		histogram, ok := l.histograms[run.ID]
+		if !ok {
+			continue
+		}
+		if isSelected[run.ID] {
+			delete(l.Judged, run.ID)
+			delete(l.Outliers, run.ID)
+		}
+		ratio := histogram.FailureRatio()
+		if len(baseline) >= *minHistory {
+			if isSelected[run.ID] {
+				l.Judged[run.ID] = true
+			}
+			ratios := make([]float64, 0, len(baseline))
+			ids := make([]int64, 0, len(baseline))
+			for _, b := range baseline {
+				ratios = append(ratios, l.histograms[b.ID].FailureRatio())
+				ids = append(ids, b.ID)
+			}
+			mean, stdDev := meanAndStdDev(ratios)
+			if ratio-mean >= *minIncrease && ratio-mean > *sigma*stdDev {
+				if isSelected[run.ID] {
+					l.Outliers[run.ID] = outlier{
+						ID:        run.ID,
+						Product:   name,
+						Histogram: histogram,
+						Ratio:     ratio,
+						Mean:      mean,
+						StdDev:    stdDev,
+						Baseline:  ids,
+					}
+				}
+				continue
+			}
+		}
+		baseline = append(baseline, run)
+		if len(baseline) > *historySize {
+			baseline = baseline[1:]
+		}
+	}
+}
+
+func (l suspectLabeller) ShouldProcessRun(run *shared.TestRun) bool {
+	if !l.Judged[run.ID] {
+		return false
+	}
+	_, isSuspect := l.Outliers[run.ID]
+	return isSuspect != run.LabelsSet().Contains(suspect)
+}
+
+func (l suspectLabeller) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	labels := make([]string, 0, len(run.Labels)+1)
+	for _, label := range run.Labels {
+		if label != suspect {
+			labels = append(labels, label)
+		}
+	}
+	if o, isSuspect := l.Outliers[run.ID]; isSuspect {
+		log.Printf("TestRun %d (%s): failure ratio %.3f vs. %.3f ± %.3f", run.ID, o.Product, o.Ratio, o.Mean, o.StdDev)
+		labels = append(labels, suspect)
+	}
+	run.Labels = labels
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the suspect runs with their status histograms and baselines,
+// and the runs whose report could not be fetched.
+func (l suspectLabeller) Report() interface{} {
+	outliers := make([]outlier, 0, len(l.Outliers))
+	for _, o := range l.Outliers {
+		outliers = append(outliers, o)
+	}
+	return map[string]interface{}{
+		"suspect":  outliers,
+		"failures": l.Failures,
+	}
+}
+
+func main() {
+	flag.Parse()
+	processor.MigrateData(newSuspectLabeller(processor.LoadRuns()))
+}
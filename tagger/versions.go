@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/web-platform-tests/data-migration/processor"
+	"github.com/web-platform-tests/data-migration/version"
+	"github.com/web-platform-tests/wpt.fyi/shared"
+)
+
+// majorLabelPrefix prefixes the major-version label, e.g. "major:70".
+const majorLabelPrefix = "major:"
+
+// versionRewrite is the audit record of a rewritten BrowserVersion. The
+// original is also kept in the run's provenance.
+type versionRewrite struct {
+	ID   int64  `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// versionNormalizer rewrites BrowserVersion to its normalized form (see
+// version.Version.String) and labels the run with its major version, replacing
+// any stale major-version label.
+type versionNormalizer struct {
+	mutex       *sync.Mutex
+	unparseable map[string]int
+	rewrites    map[int64]versionRewrite
+}
+
+func (n versionNormalizer) parse(run *shared.TestRun) (version.Version, bool) {
+	if !version.Known(run.BrowserName) {
+		return version.Version{}, false
+	}
+	v, err := version.Parse(run.BrowserName, run.BrowserVersion)
+	if err != nil {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		n.unparseable[run.BrowserName+" "+run.BrowserVersion]++
+		return version.Version{}, false
+	}
+	return v, true
+}
+
+// normalizedLabels returns the run's labels with exactly one major-version
+// label, for the given major version. An existing major-version label is
+// replaced in place; otherwise the label is appended.
+func normalizedLabels(run *shared.TestRun, v version.Version) []string {
+	major := fmt.Sprintf("%s%d", majorLabelPrefix, v.Major)
+	labels := make([]string, 0, len(run.Labels)+1)
+	found := false
+	for _, label := range run.Labels {
+		if !strings.HasPrefix(label, majorLabelPrefix) {
+			labels = append(labels, label)
+		} else if !found {
+			labels = append(labels, major)
+			found = true
+		}
+	}
+	if !found {
+		labels = append(labels, major)
+	}
+	return labels
+}
+
+// sameLabels reports whether the two lists have the same labels, in any order.
+func sameLabels(a, b []string) bool {
+	setA, setB := mapset.NewSet(), mapset.NewSet()
+	for _, label := range a {
+		setA.Add(label)
+	}
+	for _, label := range b {
+		setB.Add(label)
+	}
+	return setA.Equal(setB)
+}
+
+func (n versionNormalizer) ShouldProcessRun(run *shared.TestRun) bool {
+	v, ok := n.parse(run)
+	if !ok {
+		return false
+	}
+	return v.String() != run.BrowserVersion || !sameLabels(normalizedLabels(run, v), run.Labels)
+}
+
+func (n versionNormalizer) ProcessRun(tx *datastore.Transaction, key *datastore.Key, run *shared.TestRun) error {
+	v, _ := n.parse(run)
+	if v.String() != run.BrowserVersion {
+		log.Printf("TestRun %d: %s version %q -> %q", run.ID, run.BrowserName, run.BrowserVersion, v.String())
+		n.mutex.Lock()
+		n.rewrites[run.ID] = versionRewrite{ID: run.ID, From: run.BrowserVersion, To: v.String()}
+		n.mutex.Unlock()
+	}
+	run.BrowserVersion = v.String()
+	run.Labels = normalizedLabels(run, v)
+	_, err := tx.Put(key, run)
+	return err
+}
+
+// Report lists the rewritten versions with their originals, and the browser
+// versions that could not be parsed.
+func (n versionNormalizer) Report() interface{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	unparseable := make(map[string]int, len(n.unparseable))
+	for version, count := range n.unparseable {
+		unparseable[version] = count
+	}
+	rewrites := make([]versionRewrite, 0, len(n.rewrites))
+	for _, r := range n.rewrites {
+		rewrites = append(rewrites, r)
+	}
+	return map[string]interface{}{
+		"rewrites":    rewrites,
+		"unparseable": unparseable,
+	}
+}
+
+func main() {
+	processor.MigrateData(versionNormalizer{
+		mutex:       &sync.Mutex{},
+		unparseable: make(map[string]int),
+		rewrites:    make(map[int64]versionRewrite),
+	})
+}
@@ -11,7 +11,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
@@ -21,20 +20,16 @@ import (
 
 	"cloud.google.com/go/datastore"
 	gcs "cloud.google.com/go/storage"
+	"github.com/web-platform-tests/data-migration/clients"
+	"github.com/web-platform-tests/data-migration/profile"
+	"github.com/web-platform-tests/data-migration/wptgit"
 	"github.com/web-platform-tests/results-analysis/metrics"
 	wptStorage "github.com/web-platform-tests/results-analysis/metrics/storage"
 	"github.com/web-platform-tests/wpt.fyi/shared"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	billy "gopkg.in/src-d/go-billy.v4"
-	"gopkg.in/src-d/go-billy.v4/osfs"
-	git "gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/storage"
-	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
-var skipGitPull *bool
-var wptGitPath *string
 var wptDataPath *string
 var projectID *string
 var inputGcsBucket *string
@@ -48,16 +43,13 @@ func init() {
 	if !ok {
 		log.Fatal(errors.New("Failed to get golang source file path"))
 	}
-	defaultGitDir := filepath.Clean(path.Dir(srcFilePath) + "/../../.wpt")
 	defaultDataDir := filepath.Clean(path.Dir(srcFilePath) + "/../../.cache/migration")
-	wptGitPath = flag.String("wpt_git_path", defaultGitDir, "Path to WPT checkout")
 	wptDataPath = flag.String("wpt_data_path", defaultDataDir, "Path to data directory for local data from Google Cloud Storage")
 	projectID = flag.String("project_id", "wptdashboard", "Google Cloud Platform project id")
 	inputGcsBucket = flag.String("input_gcs_bucket", "wptd", "Google Cloud Storage bucket where shareded test results are stored")
 	outputGcsBucket = flag.String("output_gcs_bucket", "wptd-results", "Google Cloud Storage bucket where unified test results are stored")
 	wptdHost = flag.String("wptd_host", "wpt.fyi", "Hostname of endpoint that serves WPT Dashboard data API")
 	gcpCredentialsFile = flag.String("gcp_credentials_file", "client-secret.json", "Path to credentials file for authenticating against Google Cloud Platform services")
-	skipGitPull = flag.Bool("skip_git_pull", false, "Skip updating the local WPT git checkout")
 	rateLimitGCS = flag.Bool("rate_limit_gcs", false, "Whether or not to rate limit concurrent requests to Google Cloud Storage")
 }
 
@@ -81,57 +73,11 @@ func getRuns(ctx context.Context, client *datastore.Client) ([]*datastore.Key, [
 	return keys, testRuns
 }
 
-func getGit(s storage.Storer, fs billy.Filesystem, o *git.CloneOptions) *git.Repository {
-	repo, err := git.Open(s, fs)
-	if err == git.ErrRepositoryNotExists {
-		repo, err = git.Clone(s, fs, o)
-		if err != nil {
-			log.Fatal(err)
-		}
-		return nil
-	}
-	if err != nil {
-		log.Fatal(err)
-	}
-	wt, err := repo.Worktree()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if *skipGitPull {
-		return repo
-	}
-
-	for {
-		err = wt.Pull(&git.PullOptions{})
-
-		if err == io.EOF {
-			log.Println("EOF during git pull; retrying...")
-			continue
-		} else if err != git.NoErrAlreadyUpToDate && err != nil {
-			log.Fatal(err)
-		} else {
-			break
-		}
-	}
-	return repo
-}
-
-func getHashForRun(run shared.TestRun) (string, error) {
-	cmd := exec.Command("git", "rev-parse", run.Revision)
-	cmd.Dir = *wptGitPath
-	bytes, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	str := string(bytes)
-	return strings.Trim(str, " \t\r\n\v"), nil
-}
-
-func getRunsAndSetupGit(ctx context.Context, client *datastore.Client) ([]*datastore.Key, []shared.TestRun) {
+func getRunsAndSetupGit(ctx context.Context, client *datastore.Client) ([]*datastore.Key, []shared.TestRun, *wptgit.Resolver) {
 	var wg sync.WaitGroup
 	var keys []*datastore.Key
 	var runs []shared.TestRun
+	var index *wptgit.Index
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
@@ -139,39 +85,14 @@ func getRunsAndSetupGit(ctx context.Context, client *datastore.Client) ([]*datas
 	}()
 	go func() {
 		defer wg.Done()
-		fs := osfs.New(*wptGitPath)
-		store, err := filesystem.NewStorage(osfs.New(*wptGitPath + "/.git"))
-		if err != nil {
+		var err error
+		if index, err = wptgit.IndexAllCommits(wptgit.Open()); err != nil {
 			log.Fatal(err)
 		}
-		getGit(store, fs, &git.CloneOptions{
-			URL: "https://github.com/web-platform-tests/wpt.git",
-		})
 	}()
 	wg.Wait()
 
-	return keys, runs
-}
-
-// Currently dead code, but may be used later to batch update datastore entities missing new fields.
-func getHashes(runs []shared.TestRun) (map[string]string, map[string]error) {
-	errs := make(map[string]error)
-	hashes := make(map[string]string)
-	var wg sync.WaitGroup
-	wg.Add(len(runs))
-	for i, run := range runs {
-		go func(i int, run shared.TestRun) {
-			defer wg.Done()
-			h := run.Revision
-			if _, ok := hashes[h]; ok {
-				return
-			}
-			hashes[h], errs[h] = getHashForRun(run)
-		}(i, run)
-	}
-	wg.Wait()
-
-	return hashes, errs
+	return keys, runs, wptgit.NewResolver(index)
 }
 
 func writeJSON(ctx context.Context, bucket *gcs.BucketHandle, path string, data interface{}) error {
@@ -235,8 +156,15 @@ func streamData(ctx context.Context, bucket *gcs.BucketHandle, path string, read
 func main() {
 	flag.Parse()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	log.Printf("Loading and storing WPT checkout in %s", *wptGitPath)
+	profile.Apply(map[string]string{
+		"project_id":           "project",
+		"input_gcs_bucket":     "sharded_bucket",
+		"output_gcs_bucket":    "results_bucket",
+		"gcp_credentials_file": "credentials_file",
+	})
+	profile.GuardWrite(*projectID)
+
+	log.Printf("Loading and storing WPT checkout in %s", wptgit.Path())
 	log.Printf("Caching WPT data in %s", *wptDataPath)
 	err := os.MkdirAll(*wptDataPath, 0755)
 	if err != nil {
@@ -251,12 +179,12 @@ func main() {
 		gcOpts = append(gcOpts, option.WithCredentialsFile(*gcpCredentialsFile))
 	}
 
-	datastoreClient, err := datastore.NewClient(ctx, *projectID, gcOpts...)
+	datastoreClient, err := clients.NewDatastore(ctx, *projectID, gcOpts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	storageClient, err := gcs.NewClient(ctx, gcOpts...)
+	storageClient, err := clients.NewStorage(ctx, gcOpts...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -277,12 +205,12 @@ func main() {
 	// repeat.
 	for {
 		log.Printf("Loading runs from Datastore and initializing local web-platform-tests checkout")
-		datastoreKeys, testRuns := getRunsAndSetupGit(ctx, datastoreClient)
+		datastoreKeys, testRuns, revisions := getRunsAndSetupGit(ctx, datastoreClient)
 		outputBucket := storageClient.Bucket(*outputGcsBucket)
 
 		for i, testRun := range testRuns {
 			datastoreKey := datastoreKeys[i]
-			hash, err := getHashForRun(testRun)
+			hash, err := revisions.Resolve(testRun.Revision)
 			if err != nil {
 				log.Printf("Skipping run for unknown revision: %v", testRun)
 				continue
@@ -0,0 +1,187 @@
+package version
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/web-platform-tests/data-migration/channel"
+)
+
+// ErrUnknownFormat is returned for browser versions that do not match the
+// version format of the browser.
+var ErrUnknownFormat = errors.New("Unknown browser version format")
+
+// Version is a BrowserVersion parsed into its components, e.g.
+// "70.0.3538.9 dev" is major 70, minor 0, build 3538, patch 9 with a dev
+// channel hint.
+type Version struct {
+	Major int
+	Minor int
+	Build int
+	Patch int
+	// Components is the number of numeric components present in the version,
+	// e.g. 2 for "68.0a1".
+	Components int
+	// Channel is the release channel of the version, as channel.Infer returns
+	// it (from the same patterns), or "" if no pattern matched.
+	Channel string
+	// Preview is the number of a preview build, i.e. the Safari Technology
+	// Preview release, or the Firefox alpha/beta number; 0 if none.
+	Preview int
+	// WebKitBuild is the WebKit build some Safari versions are suffixed with,
+	// e.g. "14607.1.40.1.4".
+	WebKitBuild string
+
+	// suffix is the canonical form of everything following the numbers.
+	suffix string
+}
+
+// String returns the normalized version string, from which Parse returns the
+// same Version.
+func (v Version) String() string {
+	numbers := []int{v.Major, v.Minor, v.Build, v.Patch}[:v.Components]
+	parts := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, ".") + v.suffix
+}
+
+var numbers = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.(\d+))?`)
+
+// parser parses the remainder of a version string (after the numbers) into v.
+// The channel is not the parser's concern; Parse gets it from the channel
+// package.
+type parser func(v *Version, rest string) error
+
+var chromeHint = regexp.MustCompile(`(?i)^ (stable|beta|dev|canary)$`)
+
+func parseChrome(v *Version, rest string) error {
+	if rest == "" {
+		return nil
+	}
+	match := chromeHint.FindStringSubmatch(rest)
+	if match == nil {
+		return ErrUnknownFormat
+	}
+	v.suffix = " " + strings.ToLower(match[1])
+	return nil
+}
+
+var edgeHint = regexp.MustCompile(`(?i)^ (preview|insider)$`)
+
+func parseEdge(v *Version, rest string) error {
+	if match := edgeHint.FindStringSubmatch(rest); match != nil {
+		v.suffix = " " + strings.ToLower(match[1])
+		return nil
+	}
+	return parseChrome(v, rest)
+}
+
+var firefoxHint = regexp.MustCompile(`(?i)^(?:([ab])(\d+)|(esr))$`)
+
+func parseFirefox(v *Version, rest string) error {
+	if rest == "" {
+		return nil
+	}
+	match := firefoxHint.FindStringSubmatch(rest)
+	if match == nil {
+		return ErrUnknownFormat
+	}
+	if match[3] != "" {
+		v.suffix = "esr"
+		return nil
+	}
+	v.Preview, _ = strconv.Atoi(match[2])
+	v.suffix = strings.ToLower(match[1]) + strconv.Itoa(v.Preview)
+	return nil
+}
+
+var safariPreview = regexp.MustCompile(`(?i)^ ?\(?(?:safari )?technology preview (?:release )?(\d+)\)?$`)
+var safariBuild = regexp.MustCompile(`^ ?\((\d+(?:\.\d+)*)\)$`)
+
+func parseSafari(v *Version, rest string) error {
+	if rest == "" {
+		return nil
+	}
+	if match := safariPreview.FindStringSubmatch(rest); match != nil {
+		v.Preview, _ = strconv.Atoi(match[1])
+		v.suffix = fmt.Sprintf(" (Safari Technology Preview %d)", v.Preview)
+		return nil
+	}
+	if match := safariBuild.FindStringSubmatch(rest); match != nil {
+		v.WebKitBuild = match[1]
+		v.suffix = " (" + v.WebKitBuild + ")"
+		return nil
+	}
+	return ErrUnknownFormat
+}
+
+func parseWebKitGTK(v *Version, rest string) error {
+	if rest != "" {
+		return ErrUnknownFormat
+	}
+	return nil
+}
+
+// Servo versions carry arbitrary suffixes, e.g. "0.0.1-8e57f2b".
+func parseServo(v *Version, rest string) error {
+	v.suffix = rest
+	return nil
+}
+
+// parsers maps each browser name to the parser of its version suffixes.
+var parsers = map[string]parser{
+	"chrome":          parseChrome,
+	"chrome_android":  parseChrome,
+	"android_webview": parseChrome,
+	"chromium":        parseChrome,
+	"deno":            parseChrome,
+	"uc":              parseChrome,
+	"edge":            parseEdge,
+	"firefox":         parseFirefox,
+	"firefox_android": parseFirefox,
+	"safari":          parseSafari,
+	"webkitgtk":       parseWebKitGTK,
+	"epiphany":        parseWebKitGTK,
+	"servo":           parseServo,
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// Known reports whether the version format (and channel patterns) of the
+// browser are known.
+func Known(browserName string) bool {
+	_, ok := parsers[strings.TrimSuffix(browserName, "-experimental")]
+	return ok && channel.Known(browserName)
+}
+
+// Parse parses the BrowserVersion of a run of the given browser.
+func Parse(browserName, browserVersion string) (Version, error) {
+	parse, ok := parsers[strings.TrimSuffix(browserName, "-experimental")]
+	if !ok {
+		return Version{}, fmt.Errorf("Unknown browser %s", browserName)
+	}
+	s := spaces.ReplaceAllString(strings.TrimSpace(browserVersion), " ")
+	match := numbers.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, ErrUnknownFormat
+	}
+	var v Version
+	components := []*int{&v.Major, &v.Minor, &v.Build, &v.Patch}
+	for i, n := range match[1:] {
+		if n == "" {
+			break
+		}
+		*components[i], _ = strconv.Atoi(n)
+		v.Components++
+	}
+	if err := parse(&v, s[len(match[0]):]); err != nil {
+		return Version{}, err
+	}
+	v.Channel, _ = channel.Match(browserName, s)
+	return v, nil
+}
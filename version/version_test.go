@@ -0,0 +1,66 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/web-platform-tests/data-migration/channel"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		browser, version string
+		normalized       string
+		major, preview   int
+		channel          string
+	}{
+		{"chrome", "70.0.3538.77", "70.0.3538.77", 70, 0, channel.Stable},
+		{"chrome", "70.0.3538.9  Dev", "70.0.3538.9 dev", 70, 0, channel.Dev},
+		{"chrome", "70.0 Stable", "70.0 stable", 70, 0, channel.Stable},
+		{"chrome-experimental", "72.0.3626.7 beta", "72.0.3626.7 beta", 72, 0, channel.Beta},
+		{"chromium", "72.0.3626.0 dev", "72.0.3626.0 dev", 72, 0, channel.Nightly},
+		{"edge", "18.17763 preview", "18.17763 preview", 18, 0, channel.Dev},
+		{"firefox", "64.0a1", "64.0a1", 64, 1, channel.Nightly},
+		{"firefox", "63.0B12", "63.0b12", 63, 12, channel.Beta},
+		{"firefox", "60.2.0esr", "60.2.0esr", 60, 0, channel.Stable},
+		{"safari", "12.0 (14606.1.36.1.9)", "12.0 (14606.1.36.1.9)", 12, 0, channel.Stable},
+		{"safari", "12.1 (Safari Technology Preview 70)", "12.1 (Safari Technology Preview 70)", 12, 70, channel.Preview},
+		{"safari", "12.1 Technology Preview 70", "12.1 (Safari Technology Preview 70)", 12, 70, channel.Preview},
+		{"webkitgtk", "2.23.1", "2.23.1", 2, 0, channel.Dev},
+		{"webkitgtk", "2.22.0", "2.22.0", 2, 0, channel.Stable},
+		{"servo", "0.0.1-8e57f2b", "0.0.1-8e57f2b", 0, 0, channel.Nightly},
+	}
+	for _, test := range tests {
+		v, err := Parse(test.browser, test.version)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %s", test.browser, test.version, err.Error())
+			continue
+		}
+		if v.String() != test.normalized || v.Major != test.major || v.Preview != test.preview || v.Channel != test.channel {
+			t.Errorf("Parse(%q, %q) = %q (major %d, preview %d, %s); expected %q (major %d, preview %d, %s)",
+				test.browser, test.version, v.String(), v.Major, v.Preview, v.Channel,
+				test.normalized, test.major, test.preview, test.channel)
+		}
+		if again, err := Parse(test.browser, v.String()); err != nil || again != v {
+			t.Errorf("Parse(%q, %q) does not round-trip: %+v, %v", test.browser, v.String(), again, err)
+		}
+		if c, _ := channel.Infer(test.browser, test.version); c != v.Channel {
+			t.Errorf("channel.Infer(%q, %q) = %s, but Parse found %s", test.browser, test.version, c, v.Channel)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct{ browser, version string }{
+		{"chrome", "70.0 foo"},
+		{"chrome", "dev"},
+		{"firefox", "64.0x1"},
+		{"safari", "12.1 (foo)"},
+		{"webkitgtk", "2.22.0 nightly"},
+		{"netscape", "4.0"},
+	}
+	for _, test := range tests {
+		if v, err := Parse(test.browser, test.version); err == nil {
+			t.Errorf("Parse(%q, %q) = %+v; expected an error", test.browser, test.version, v)
+		}
+	}
+}
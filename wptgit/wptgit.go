@@ -0,0 +1,204 @@
+package wptgit
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+var wptGitPath *string
+var skipGitPull *bool
+
+func init() {
+	_, srcFilePath, _, ok := runtime.Caller(0)
+	if !ok {
+		log.Fatal(errors.New("Failed to get golang source file path"))
+	}
+	defaultGitDir := filepath.Clean(path.Dir(srcFilePath) + "/../../.wpt")
+	wptGitPath = flag.String("wpt_git_path", defaultGitDir, "Path to WPT checkout")
+	skipGitPull = flag.Bool("skip_git_pull", false, "Skip updating the local WPT git checkout")
+}
+
+// ErrUnknownRevision is returned for revisions that match no commit.
+var ErrUnknownRevision = errors.New("Unknown revision")
+
+// ErrAmbiguousRevision is returned for abbreviated revisions that match more
+// than one commit.
+var ErrAmbiguousRevision = errors.New("Ambiguous revision")
+
+// Path returns the path of the local WPT checkout.
+func Path() string {
+	return *wptGitPath
+}
+
+// Open opens the local WPT checkout (cloning it first if it does not exist)
+// and, unless --skip_git_pull is set, pulls the latest changes.
+func Open() *git.Repository {
+	fs := osfs.New(*wptGitPath)
+	s, err := filesystem.NewStorage(osfs.New(*wptGitPath + "/.git"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	repo, err := git.Open(s, fs)
+	if err == git.ErrRepositoryNotExists {
+		repo, err = git.Clone(s, fs, &git.CloneOptions{
+			URL: "https://github.com/web-platform-tests/wpt.git",
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return repo
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *skipGitPull {
+		return repo
+	}
+
+	for {
+		err = wt.Pull(&git.PullOptions{})
+
+		if err == io.EOF {
+			log.Println("EOF during git pull; retrying...")
+			continue
+		} else if err != git.NoErrAlreadyUpToDate && err != nil {
+			log.Fatal(err)
+		} else {
+			break
+		}
+	}
+	return repo
+}
+
+// Commit is a commit on the first-parent history of master.
+type Commit struct {
+	Hash string
+	Time time.Time
+}
+
+// MasterHistory returns the first-parent history of origin/master (or of the
+// local master branch, if there is no remote), newest first. Commit times are
+// committer times, i.e. when the commit landed on master.
+func MasterHistory(repo *git.Repository) ([]Commit, error) {
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "master"), true)
+	if err != nil {
+		ref, err = repo.Reference(plumbing.NewBranchReferenceName("master"), true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	history := make([]Commit, 0)
+	for {
+		history = append(history, Commit{
+			Hash: commit.Hash.String(),
+			Time: commit.Committer.When.UTC(),
+		})
+		if commit.NumParents() == 0 {
+			return history, nil
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Index resolves full or abbreviated revisions to full commit hashes.
+type Index struct {
+	hashes []string
+}
+
+// NewIndex creates an Index of the given full commit hashes.
+func NewIndex(hashes []string) *Index {
+	sorted := append([]string(nil), hashes...)
+	sort.Strings(sorted)
+	return &Index{hashes: sorted}
+}
+
+// IndexAllCommits creates an Index of all commits in the repository, not just
+// those on master.
+func IndexAllCommits(repo *git.Repository) (*Index, error) {
+	iter, err := repo.CommitObjects()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0)
+	err = iter.ForEach(func(c *object.Commit) error {
+		hashes = append(hashes, c.Hash.String())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(hashes), nil
+}
+
+// Resolve returns the full hash of a full or abbreviated revision.
+func (i *Index) Resolve(revision string) (string, error) {
+	revision = strings.ToLower(strings.TrimSpace(revision))
+	if revision == "" {
+		return "", ErrUnknownRevision
+	}
+	n := sort.SearchStrings(i.hashes, revision)
+	if n == len(i.hashes) || !strings.HasPrefix(i.hashes[n], revision) {
+		return "", ErrUnknownRevision
+	}
+	if n+1 < len(i.hashes) && strings.HasPrefix(i.hashes[n+1], revision) {
+		return "", ErrAmbiguousRevision
+	}
+	return i.hashes[n], nil
+}
+
+// Resolver resolves revisions like Index, caching the results. It is safe for
+// concurrent use.
+type Resolver struct {
+	index *Index
+	mutex sync.Mutex
+	cache map[string]resolution
+}
+
+type resolution struct {
+	hash string
+	err  error
+}
+
+// NewResolver creates a Resolver over the given Index.
+func NewResolver(index *Index) *Resolver {
+	return &Resolver{index: index, cache: make(map[string]resolution)}
+}
+
+// Resolve returns the full hash of a full or abbreviated revision, or
+// ErrUnknownRevision or ErrAmbiguousRevision.
+func (r *Resolver) Resolve(revision string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if res, ok := r.cache[revision]; ok {
+		return res.hash, res.err
+	}
+	hash, err := r.index.Resolve(revision)
+	r.cache[revision] = resolution{hash, err}
+	return hash, err
+}